@@ -0,0 +1,47 @@
+package syslog
+
+import (
+	"context"
+
+	"github.com/LOKE/pkg/requestid"
+	"github.com/LOKE/pkg/tracing"
+	"github.com/go-kit/log"
+)
+
+// ctxKey is an unexported type for context keys defined in this package.
+// This prevents collisions with keys defined in other packages.
+type ctxKey int
+
+// loggerKey is the key for log.Logger values in Contexts.
+var loggerKey ctxKey
+
+// NewContext returns a new Context that carries logger.
+func NewContext(ctx context.Context, logger log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the Logger stored in ctx, if any. Loggers stored by
+// lokerpc handlers already carry the rpc_service and method keys, as well as
+// those added by WithContext.
+func FromContext(ctx context.Context) (log.Logger, bool) {
+	l, ok := ctx.Value(loggerKey).(log.Logger)
+	return l, ok
+}
+
+// WithContext returns logger with the request_id, trace_id and span_id keys
+// set from ctx, for those that are present.
+func WithContext(ctx context.Context, logger log.Logger) log.Logger {
+	var keyvals []interface{}
+
+	if id, ok := requestid.FromContext(ctx); ok {
+		keyvals = append(keyvals, "request_id", id.String())
+	}
+	if sc, ok := tracing.FromContext(ctx); ok && sc.IsValid() {
+		keyvals = append(keyvals, "trace_id", sc.TraceID.String(), "span_id", sc.SpanID.String())
+	}
+
+	if len(keyvals) == 0 {
+		return logger
+	}
+	return log.With(logger, keyvals...)
+}
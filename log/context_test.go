@@ -0,0 +1,79 @@
+package syslog_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	lokelog "github.com/LOKE/pkg/log"
+	"github.com/LOKE/pkg/requestid"
+	"github.com/LOKE/pkg/tracing"
+	"github.com/go-kit/log"
+)
+
+func TestWithContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := requestid.NewContext(context.Background(), requestid.NewRequestID())
+	ctx, span := tracing.NewTracer(nil).Start(ctx, "test", tracing.KindInternal)
+	defer span.End()
+
+	id, _ := requestid.FromContext(ctx)
+	sc := span.SpanContext()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "empty context",
+			ctx:  context.Background(),
+			want: "msg=hello\n",
+		},
+		{
+			name: "request and trace ids",
+			ctx:  ctx,
+			want: "request_id=" + id.String() + " trace_id=" + sc.TraceID.String() + " span_id=" + sc.SpanID.String() + " msg=hello\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			l := lokelog.WithContext(tt.ctx, log.NewLogfmtLogger(&buf))
+			if err := l.Log("msg", "hello"); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := lokelog.FromContext(context.Background()); ok {
+		t.Error("expected no logger in empty context")
+	}
+
+	var buf bytes.Buffer
+	ctx := lokelog.NewContext(context.Background(), log.With(log.NewLogfmtLogger(&buf), "key", "value"))
+
+	l, ok := lokelog.FromContext(ctx)
+	if !ok {
+		t.Fatal("expected logger in context")
+	}
+	_ = l.Log("msg", "hello")
+
+	if !strings.Contains(buf.String(), "key=value msg=hello") {
+		t.Errorf("expected stored logger to be returned, got %q", buf.String())
+	}
+}
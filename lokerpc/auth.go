@@ -0,0 +1,121 @@
+package lokerpc
+
+import (
+	"context"
+	"net/http"
+)
+
+// Principal is the authenticated caller of an rpc.
+type Principal struct {
+	// Subject identifies the caller, e.g. a user or service name.
+	Subject string
+	// Scopes are the permissions granted to the caller.
+	Scopes []string
+	// Claims holds any other information the Authenticator extracted, such
+	// as JWT claims.
+	Claims map[string]any
+}
+
+// HasScope reports whether p has been granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the caller of a request.
+//
+// Authenticate returns a nil Principal and nil error if the request carries
+// none of the credentials it understands, so authenticators can be combined.
+// Invalid credentials should return an error, which is served with a 401
+// status unless it is categorised.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate calls f.
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// ErrUnauthenticated is returned when a call requires a Principal, but none
+// was authenticated.
+var ErrUnauthenticated = &Error{
+	Message:   "authentication required",
+	Code:      "UNAUTHENTICATED",
+	Namespace: "lokerpc",
+	Expose:    true,
+	Category:  CategoryUnauthorised,
+}
+
+// ErrForbidden is returned when the Principal lacks a scope the endpoint
+// requires.
+var ErrForbidden = &Error{
+	Message:   "missing required scope",
+	Code:      "FORBIDDEN",
+	Namespace: "lokerpc",
+	Expose:    true,
+	Category:  CategoryForbidden,
+}
+
+// WithAuthenticator authenticates every call to the service with a. Calls
+// without credentials are rejected with ErrUnauthenticated.
+func WithAuthenticator(a Authenticator) ServiceOption {
+	return func(o *serviceOptions) {
+		o.authenticator = a
+	}
+}
+
+// RequireScopes rejects calls to the endpoint unless the Principal has all
+// of scopes. The scopes are advertised in the metadata.
+func RequireScopes(scopes ...string) EndpointCodecOption {
+	return func(ec *EndpointCodec) {
+		ec.scopes = append(ec.scopes[:len(ec.scopes):len(ec.scopes)], scopes...)
+	}
+}
+
+type principalKey struct{}
+
+// NewPrincipalContext returns a copy of ctx carrying p.
+func NewPrincipalContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the Principal of the call handling ctx.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// authorise authenticates r with a, if set, and checks the Principal has
+// scopes. It returns the Principal, which may be nil if neither are needed.
+func authorise(r *http.Request, a Authenticator, scopes []string) (*Principal, error) {
+	var p *Principal
+	if a != nil {
+		var err error
+		if p, err = a.Authenticate(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if p == nil {
+		if a != nil || len(scopes) > 0 {
+			return nil, ErrUnauthenticated
+		}
+		return nil, nil
+	}
+
+	for _, s := range scopes {
+		if !p.HasScope(s) {
+			return nil, ErrForbidden
+		}
+	}
+
+	return p, nil
+}
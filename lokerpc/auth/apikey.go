@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+// DefaultAPIKeyHeader is the header API keys are read from if none is given.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKeys returns an Authenticator for shared keys sent in header, which
+// defaults to DefaultAPIKeyHeader. keys maps each key to the Principal it
+// authenticates.
+func APIKeys(header string, keys map[string]lokerpc.Principal) lokerpc.Authenticator {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+
+	// Keys are looked up by hash so lookups don't leak the keys through timing
+	byHash := make(map[[sha256.Size]byte]lokerpc.Principal, len(keys))
+	for k, p := range keys {
+		byHash[sha256.Sum256([]byte(k))] = p
+	}
+
+	return lokerpc.AuthenticatorFunc(func(r *http.Request) (*lokerpc.Principal, error) {
+		key := r.Header.Get(header)
+		if key == "" {
+			return nil, nil
+		}
+
+		p, ok := byHash[sha256.Sum256([]byte(key))]
+		if !ok {
+			return nil, invalidCredentials("invalid API key")
+		}
+		return &p, nil
+	})
+}
@@ -0,0 +1,40 @@
+// Package auth provides lokerpc Authenticators for JWT bearer tokens, mTLS
+// client certificates and shared API keys.
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+// ErrInvalidCredentials is returned when a request carries credentials that
+// can't be verified. Compare with errors.Is, as the message varies.
+var ErrInvalidCredentials = &lokerpc.Error{
+	Message:   "invalid credentials",
+	Code:      "INVALID_CREDENTIALS",
+	Namespace: "lokerpc.auth",
+	Expose:    true,
+	Category:  lokerpc.CategoryUnauthorised,
+}
+
+func invalidCredentials(format string, a ...any) error {
+	e := *ErrInvalidCredentials
+	e.Message = fmt.Sprintf(format, a...)
+	return &e
+}
+
+// FirstOf returns an Authenticator that tries each of as in turn, returning
+// the first Principal found. Invalid credentials stop the search.
+func FirstOf(as ...lokerpc.Authenticator) lokerpc.Authenticator {
+	return lokerpc.AuthenticatorFunc(func(r *http.Request) (*lokerpc.Principal, error) {
+		for _, a := range as {
+			p, err := a.Authenticate(r)
+			if err != nil || p != nil {
+				return p, err
+			}
+		}
+		return nil, nil
+	})
+}
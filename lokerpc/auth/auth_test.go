@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LOKE/pkg/lokerpc"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	auth := APIKeys("", map[string]lokerpc.Principal{
+		"key-1": {Subject: "menus", Scopes: []string{"orders:read"}},
+	})
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("X-API-Key", "key-1")
+	p, err := auth.Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&lokerpc.Principal{Subject: "menus", Scopes: []string{"orders:read"}}, p); diff != "" {
+		t.Errorf("principal mismatch (-want +got):\n%s", diff)
+	}
+
+	r.Header.Set("X-API-Key", "key-2")
+	if _, err := auth.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected invalid credentials, got %v", err)
+	}
+}
+
+func TestMTLS(t *testing.T) {
+	t.Parallel()
+
+	auth := MTLS(func(c *x509.Certificate) []string {
+		return c.Subject.OrganizationalUnit
+	})
+
+	r := httptest.NewRequest("POST", "/", nil)
+	if p, err := auth.Authenticate(r); p != nil || err != nil {
+		t.Errorf("expected no principal without tls, got %v, %v", p, err)
+	}
+
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "orders", OrganizationalUnit: []string{"menus:read"}}},
+	}}}
+	p, err := auth.Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&lokerpc.Principal{Subject: "orders", Scopes: []string{"menus:read"}}, p); diff != "" {
+		t.Errorf("principal mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFirstOf(t *testing.T) {
+	t.Parallel()
+
+	auth := FirstOf(
+		JWT(JWTOptions{}),
+		APIKeys("", map[string]lokerpc.Principal{"key-1": {Subject: "menus"}}),
+	)
+
+	r := httptest.NewRequest("POST", "/", nil)
+	if p, err := auth.Authenticate(r); p != nil || err != nil {
+		t.Errorf("expected no principal, got %v, %v", p, err)
+	}
+
+	r.Header.Set("X-API-Key", "key-1")
+	if p, err := auth.Authenticate(r); err != nil || p.Subject != "menus" {
+		t.Errorf("expected api key principal, got %v, %v", p, err)
+	}
+
+	r.Header.Set("Authorization", "Bearer bad")
+	if _, err := auth.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected invalid bearer token to stop search, got %v", err)
+	}
+}
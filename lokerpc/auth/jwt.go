@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+// JWTOptions configures the JWT Authenticator.
+type JWTOptions struct {
+	// HMACKeys are the secrets HS256 tokens are verified with, by key id. The
+	// key with an empty id is used for tokens without a "kid" header.
+	HMACKeys map[string][]byte
+	// RSAKeys are the public keys RS256 tokens are verified with, by key id.
+	RSAKeys map[string]*rsa.PublicKey
+	// Issuer, if set, must match the "iss" claim.
+	Issuer string
+	// Audience, if set, must be in the "aud" claim.
+	Audience string
+	// Leeway allows for clock skew when checking "exp" and "nbf".
+	Leeway time.Duration
+	// RequireExp rejects tokens without an "exp" claim.
+	RequireExp bool
+}
+
+// JWT returns an Authenticator for JWT bearer tokens in the Authorization
+// header. The Principal's Subject is the "sub" claim, and its Scopes come from
+// the space separated "scope" claim, or the "scp" array.
+func JWT(opts JWTOptions) lokerpc.Authenticator {
+	return lokerpc.AuthenticatorFunc(func(r *http.Request) (*lokerpc.Principal, error) {
+		token, ok := bearerToken(r)
+		if !ok {
+			return nil, nil
+		}
+		return opts.verify(token, time.Now())
+	})
+}
+
+// ParseRSAPublicKey parses a PEM encoded PKIX or PKCS #1 RSA public key, for
+// use in JWTOptions.RSAKeys.
+func ParseRSAPublicKey(pemBytes []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return rsaKey, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (o JWTOptions) verify(token string, now time.Time) (*lokerpc.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidCredentials("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidCredentials("malformed token header")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidCredentials("malformed token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// The key is chosen by algorithm, so a public key can never be used as a
+	// HMAC secret
+	switch header.Alg {
+	case "HS256":
+		key, ok := o.HMACKeys[header.Kid]
+		if !ok {
+			return nil, invalidCredentials("unknown key %q", header.Kid)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, invalidCredentials("invalid token signature")
+		}
+	case "RS256":
+		key, ok := o.RSAKeys[header.Kid]
+		if !ok {
+			return nil, invalidCredentials("unknown key %q", header.Kid)
+		}
+		sum := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+			return nil, invalidCredentials("invalid token signature")
+		}
+	default:
+		return nil, invalidCredentials("unsupported token algorithm %q", header.Alg)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidCredentials("malformed token claims")
+	}
+
+	if err := o.validate(claims, now); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &lokerpc.Principal{
+		Subject: sub,
+		Scopes:  scopes(claims),
+		Claims:  claims,
+	}, nil
+}
+
+func (o JWTOptions) validate(claims map[string]any, now time.Time) error {
+	exp, ok, err := numericDate(claims, "exp")
+	switch {
+	case err != nil:
+		return err
+	case ok && !now.Before(exp.Add(o.Leeway)):
+		return invalidCredentials("token expired")
+	case !ok && o.RequireExp:
+		return invalidCredentials("token has no expiry")
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(o.Leeway).Before(nbf) {
+		return invalidCredentials("token not yet valid")
+	}
+
+	if o.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != o.Issuer {
+			return invalidCredentials("unexpected token issuer")
+		}
+	}
+
+	if o.Audience != "" && !hasAudience(claims["aud"], o.Audience) {
+		return invalidCredentials("unexpected token audience")
+	}
+
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// maxNumericDate is the largest NumericDate, in seconds, representable in
+// nanoseconds as an int64.
+const maxNumericDate = float64(math.MaxInt64 / int64(time.Second))
+
+// numericDate returns the NumericDate claim called name, and whether it was
+// present. A claim that is present but not a valid NumericDate is an error,
+// rather than being treated as absent.
+func numericDate(claims map[string]any, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, invalidCredentials("malformed %q claim", name)
+	}
+	f, err := n.Float64()
+	if err != nil || math.IsNaN(f) || math.Abs(f) > maxNumericDate {
+		return time.Time{}, false, invalidCredentials("malformed %q claim", name)
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true, nil
+}
+
+func hasAudience(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func scopes(claims map[string]any) []string {
+	if s, ok := claims["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+
+	scp, _ := claims["scp"].([]any)
+	var out []string
+	for _, s := range scp {
+		if s, ok := s.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func signJWT(t *testing.T, header, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+
+	seg := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signed := seg(header) + "." + seg(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(key []byte) func([]byte) []byte {
+	return func(b []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey) func([]byte) []byte {
+	return func(b []byte) []byte {
+		sum := sha256.Sum256(b)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+}
+
+func TestJWT(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := JWT(JWTOptions{
+		HMACKeys: map[string][]byte{"": secret},
+		RSAKeys:  map[string]*rsa.PublicKey{"rsa1": &rsaKey.PublicKey},
+		Issuer:   "loke",
+		Audience: "orders",
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := map[string]any{"sub": "user-1", "iss": "loke", "aud": "orders", "exp": exp, "scope": "orders:read orders:write"}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantSub    string
+		wantScopes []string
+		wantErr    bool
+	}{
+		{
+			name:       "hs256",
+			token:      signJWT(t, map[string]any{"alg": "HS256"}, valid, hs256(secret)),
+			wantSub:    "user-1",
+			wantScopes: []string{"orders:read", "orders:write"},
+		},
+		{
+			name: "rs256 with scp",
+			token: signJWT(t, map[string]any{"alg": "RS256", "kid": "rsa1"}, map[string]any{
+				"sub": "svc", "iss": "loke", "aud": []string{"menus", "orders"}, "scp": []string{"orders:read"},
+			}, rs256(t, rsaKey)),
+			wantSub:    "svc",
+			wantScopes: []string{"orders:read"},
+		},
+		{
+			name:    "bad signature",
+			token:   signJWT(t, map[string]any{"alg": "HS256"}, valid, hs256([]byte("other"))),
+			wantErr: true,
+		},
+		{
+			name:    "alg none",
+			token:   signJWT(t, map[string]any{"alg": "none"}, valid, func([]byte) []byte { return nil }),
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			token:   signJWT(t, map[string]any{"alg": "RS256", "kid": "rsa2"}, valid, rs256(t, rsaKey)),
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: signJWT(t, map[string]any{"alg": "HS256"}, map[string]any{
+				"sub": "user-1", "iss": "loke", "aud": "orders", "exp": time.Now().Add(-time.Minute).Unix(),
+			}, hs256(secret)),
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			token: signJWT(t, map[string]any{"alg": "HS256"}, map[string]any{
+				"sub": "user-1", "iss": "loke", "aud": "menus", "exp": exp,
+			}, hs256(secret)),
+			wantErr: true,
+		},
+		{
+			name: "non numeric exp",
+			token: signJWT(t, map[string]any{"alg": "HS256"}, map[string]any{
+				"sub": "user-1", "iss": "loke", "aud": "orders", "exp": "tomorrow",
+			}, hs256(secret)),
+			wantErr: true,
+		},
+		{
+			name: "null nbf",
+			token: signJWT(t, map[string]any{"alg": "HS256"}, map[string]any{
+				"sub": "user-1", "iss": "loke", "aud": "orders", "exp": exp, "nbf": nil,
+			}, hs256(secret)),
+			wantErr: true,
+		},
+		{
+			name: "out of range exp",
+			token: signJWT(t, map[string]any{"alg": "HS256"}, map[string]any{
+				"sub": "user-1", "iss": "loke", "aud": "orders", "exp": 1e300,
+			}, hs256(secret)),
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-jwt",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("POST", "/rpc/orders/getOrder", nil)
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+
+			p, err := auth.Authenticate(r)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("expected invalid credentials, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Subject != tc.wantSub {
+				t.Errorf("expected subject %q, got %q", tc.wantSub, p.Subject)
+			}
+			if diff := cmp.Diff(tc.wantScopes, p.Scopes); diff != "" {
+				t.Errorf("scopes mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJWTRequireExp(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	auth := JWT(JWTOptions{HMACKeys: map[string][]byte{"": secret}, RequireExp: true})
+
+	for name, tc := range map[string]struct {
+		claims  map[string]any
+		wantErr bool
+	}{
+		"with exp":    {claims: map[string]any{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}},
+		"without exp": {claims: map[string]any{"sub": "user-1"}, wantErr: true},
+	} {
+		r := httptest.NewRequest("POST", "/rpc/orders/getOrder", nil)
+		r.Header.Set("Authorization", "Bearer "+signJWT(t, map[string]any{"alg": "HS256"}, tc.claims, hs256(secret)))
+
+		_, err := auth.Authenticate(r)
+		if tc.wantErr && !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected invalid credentials, got %v", name, err)
+		}
+		if !tc.wantErr && err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestJWTWithoutToken(t *testing.T) {
+	t.Parallel()
+
+	p, err := JWT(JWTOptions{}).Authenticate(httptest.NewRequest("POST", "/", nil))
+	if p != nil || err != nil {
+		t.Errorf("expected no principal or error, got %v, %v", p, err)
+	}
+}
+
+func TestParseRSAPublicKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, block := range map[string]*pem.Block{
+		"pkix":  {Type: "PUBLIC KEY", Bytes: der},
+		"pkcs1": {Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)},
+	} {
+		got, err := ParseRSAPublicKey(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !got.Equal(&key.PublicKey) {
+			t.Errorf("%s: parsed key doesn't match", name)
+		}
+	}
+}
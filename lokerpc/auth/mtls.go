@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+// MTLS returns an Authenticator for verified TLS client certificates. The
+// server's tls.Config must verify client certificates, e.g. with
+// tls.VerifyClientCertIfGiven. The Principal's Subject is the certificate's
+// common name, or its first URI SAN (such as a SPIFFE id) if it has none.
+// scopes, if not nil, returns the scopes granted to the certificate.
+func MTLS(scopes func(*x509.Certificate) []string) lokerpc.Authenticator {
+	return lokerpc.AuthenticatorFunc(func(r *http.Request) (*lokerpc.Principal, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return nil, nil
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+
+		p := &lokerpc.Principal{Subject: cert.Subject.CommonName}
+		if p.Subject == "" && len(cert.URIs) > 0 {
+			p.Subject = cert.URIs[0].String()
+		}
+		if scopes != nil {
+			p.Scopes = scopes(cert)
+		}
+
+		return p, nil
+	})
+}
@@ -0,0 +1,133 @@
+package lokerpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+var testAuthenticator = AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+	switch r.Header.Get("Authorization") {
+	case "":
+		return nil, nil
+	case "Bearer reader":
+		return &Principal{Subject: "reader", Scopes: []string{"orders:read"}}, nil
+	default:
+		return nil, errors.New("bad token")
+	}
+})
+
+func TestAuthorisation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		auth       Authenticator
+		scopes     []string
+		header     string
+		wantStatus int
+		wantSub    string
+	}{
+		{
+			name:       "open without authenticator",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "scopes require a principal",
+			scopes:     []string{"orders:read"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "authenticator requires credentials",
+			auth:       testAuthenticator,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid credentials",
+			auth:       testAuthenticator,
+			header:     "Bearer forged",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing scope",
+			auth:       testAuthenticator,
+			scopes:     []string{"orders:write"},
+			header:     "Bearer reader",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "has scope",
+			auth:       testAuthenticator,
+			scopes:     []string{"orders:read"},
+			header:     "Bearer reader",
+			wantStatus: http.StatusOK,
+			wantSub:    "reader",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotSub string
+
+			var opts []ServiceOption
+			if tc.auth != nil {
+				opts = append(opts, WithAuthenticator(tc.auth))
+			}
+
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, NewService("orders", "", EndpointCodecMap{
+				"getOrder": MakeVoidEndpointCodec(func(ctx context.Context, _ getOrderRequest) error {
+					if p, ok := PrincipalFromContext(ctx); ok {
+						gotSub = p.Subject
+					}
+					return nil
+				}, "", RequireScopes(tc.scopes...)),
+			}, opts...))
+
+			req := httptest.NewRequest(http.MethodPost, "/rpc/orders/getOrder", strings.NewReader(`{"id":"1"}`))
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if gotSub != tc.wantSub {
+				t.Errorf("expected principal %q, got %q", tc.wantSub, gotSub)
+			}
+		})
+	}
+}
+
+func TestMetaScopes(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("orders", "", EndpointCodecMap{
+		"getOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error { return nil }, "", RequireScopes("orders:read", "orders:admin")),
+	}))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc/orders", nil))
+
+	var meta Meta
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"orders:read", "orders:admin"}, meta.Interfaces[0].Scopes); diff != "" {
+		t.Errorf("scopes mismatch (-want +got):\n%s", diff)
+	}
+}
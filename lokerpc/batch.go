@@ -0,0 +1,298 @@
+package lokerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LOKE/pkg/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// DefaultMaxBatchItems is the maximum number of calls in a batch if
+// BatchOptions doesn't set one.
+const DefaultMaxBatchItems = 100
+
+// BatchOptions configures the batch endpoint of a service.
+type BatchOptions struct {
+	// MaxItems is the maximum number of calls in a batch. Defaults to
+	// DefaultMaxBatchItems.
+	MaxItems int
+	// Parallelism is the number of calls run at once. Defaults to 1, which
+	// runs calls in order.
+	Parallelism int
+}
+
+// WithBatch enables the batch endpoint of the service, served from
+//
+//	POST /rpc/<service>
+//
+// It takes an array of {"method", "params"} items, and responds with an array
+// of {"status", "result"} or {"status", "error"} items in the same order. Each
+// call is handled exactly as if it was made on its own, including
+// authentication, middleware and metrics. Use Client.DoBatch to call it.
+func WithBatch(bo BatchOptions) ServiceOption {
+	return func(o *serviceOptions) {
+		o.batch = &bo
+	}
+}
+
+type batchItem struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type batchResult struct {
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// batchHandler serves batches of calls by dispatching each to the handler of
+// its method.
+type batchHandler struct {
+	logger   log.Logger
+	service  string
+	handlers map[string]http.Handler
+	opts     BatchOptions
+	decode   DecodeOptions
+}
+
+func newBatchHandler(logger log.Logger, service string, handlers map[string]http.Handler, o serviceOptions) http.Handler {
+	bo, do := *o.batch, o.decode
+	if bo.MaxItems <= 0 {
+		bo.MaxItems = DefaultMaxBatchItems
+	}
+	if bo.Parallelism <= 0 {
+		bo.Parallelism = 1
+	}
+	if do.MaxRequestSize > 0 {
+		do.MaxRequestSize *= int64(bo.MaxItems)
+	}
+
+	b := &batchHandler{
+		logger:   logger,
+		service:  service,
+		handlers: handlers,
+		opts:     bo,
+		decode:   do,
+	}
+
+	return o.requestIDMiddleware(tracing.Middleware(service+".batch", b))
+}
+
+func (b *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "405 must POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := readParams(r.Body, r.ContentLength, b.decode)
+	if errors.Is(err, errRequestTooLarge) {
+		writeError(w, CategoryTooLarge.StatusCode(), asError(errRequestTooLarge))
+		return
+	}
+	if err != nil {
+		writeBadReq(w, "JSON could not be decoded: %v", err)
+		return
+	}
+
+	var items []batchItem
+	if err := json.Unmarshal(body, &items); err != nil {
+		writeBadReq(w, "Invalid batch: %v", err)
+		return
+	}
+	if len(items) > b.opts.MaxItems {
+		writeBadReq(w, "Batch has %d calls, the maximum is %d", len(items), b.opts.MaxItems)
+		return
+	}
+
+	shareDeadline(r)
+
+	results := make([]batchResult, len(items))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, b.opts.Parallelism)
+	for i, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, item batchItem) {
+			defer func() { <-sem; wg.Done() }()
+			results[i] = b.call(r, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		level.Error(b.logger).Log("msg", "failed to write batch response", "err", err)
+	}
+}
+
+// call makes a single call of a batch, by passing a copy of the batch request
+// to the method's handler.
+func (b *batchHandler) call(r *http.Request, item batchItem) batchResult {
+	h, ok := b.handlers[item.Method]
+	if !ok {
+		return batchResult{
+			Status: http.StatusNotFound,
+			Error: &Error{
+				Message:  "Error rpc method not found: " + item.Method,
+				Expose:   true,
+				Category: CategoryNotFound,
+			},
+		}
+	}
+
+	return callHandler(r, b.service, item.Method, h, item.Params)
+}
+
+// shareDeadline converts the remaining budget of r to an absolute deadline,
+// as the budget would otherwise restart for each call made with it.
+func shareDeadline(r *http.Request) {
+	if h := r.Header.Get("X-Request-Timeout"); h != "" {
+		if ms, err := strconv.ParseInt(h, 10, 64); err == nil && ms >= 0 {
+			deadline := time.Now().Add(budgetDuration(ms))
+			r.Header.Set("X-Request-Deadline", deadline.UTC().Format(time.RFC3339Nano))
+			r.Header.Del("X-Request-Timeout")
+		}
+	}
+}
+
+// callHandler makes a call with params by passing a copy of r to the
+// method's handler, and returns its outcome.
+func callHandler(r *http.Request, service, method string, h http.Handler, params json.RawMessage) batchResult {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+
+	cr := r.Clone(r.Context())
+	cr.Method = http.MethodPost
+	cr.URL.Path = "/rpc/" + service + "/" + method
+	cr.Body = io.NopCloser(bytes.NewReader(params))
+	cr.ContentLength = int64(len(params))
+	// The call's span should be a child of the span in the context, not the
+	// caller's
+	cr.Header.Del("Traceparent")
+	cr.Header.Del("Tracestate")
+
+	bw := &bufferWriter{header: http.Header{}}
+	h.ServeHTTP(bw, cr)
+
+	return bw.result()
+}
+
+// bufferWriter is a http.ResponseWriter that holds the response in memory.
+type bufferWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *bufferWriter) result() batchResult {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := bytes.TrimSpace(w.body.Bytes())
+
+	if status < 300 {
+		if len(body) == 0 {
+			body = []byte("null")
+		}
+		return batchResult{Status: status, Result: body}
+	}
+
+	rpcErr := &Error{}
+	if !strings.HasPrefix(w.header.Get("Content-Type"), "application/json") || json.Unmarshal(body, rpcErr) != nil {
+		rpcErr = &Error{Message: string(body)}
+	}
+	return batchResult{Status: status, Error: rpcErr}
+}
+
+// BatchCall is a single call made with Client.DoBatch.
+type BatchCall struct {
+	Method string
+	Args   any
+	// Result is decoded into if the call succeeds. It may be nil.
+	Result any
+	// Err is set by DoBatch if the call failed.
+	Err error
+}
+
+// DoBatch makes calls in a single request to the service's batch endpoint,
+// which must be enabled on the server with WithBatch. The outcome of each call
+// is set on it, DoBatch only returns an error if the batch as a whole failed.
+//
+// Batches are traced, but don't pass through client middleware, metrics,
+// retries or the circuit breaker.
+func (c Client) DoBatch(ctx context.Context, calls []BatchCall) error {
+	ctx, span := tracing.Start(ctx, "batch", tracing.KindClient)
+	defer span.End()
+
+	url := strings.TrimSuffix(c.bURL, "/")
+	span.SetAttribute("rpc.url", url)
+
+	items := make([]batchItem, len(calls))
+	for i, call := range calls {
+		params, err := json.Marshal(call.Args)
+		if err != nil {
+			return err
+		}
+		items[i] = batchItem{Method: call.Method, Params: params}
+	}
+
+	var results []batchResult
+	if err := c.post(ctx, url, items, &results); err != nil {
+		span.SetError(err)
+		return err
+	}
+	if len(results) != len(calls) {
+		err := fmt.Errorf("Error rpc batch returned %d results for %d calls", len(results), len(calls))
+		span.SetError(err)
+		return err
+	}
+
+	for i, res := range results {
+		calls[i].Err = nil
+
+		if res.Error != nil {
+			res.Error.Category = CategoryFromStatus(res.Status)
+			calls[i].Err = res.Error
+			continue
+		}
+		if calls[i].Result == nil {
+			continue
+		}
+		if err := json.Unmarshal(res.Result, calls[i].Result); err != nil {
+			calls[i].Err = fmt.Errorf("Error decoding rpc response: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package lokerpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+type orderTotal struct {
+	Total float64 `json:"total"`
+}
+
+func newBatchService(calls *int32, opts ...ServiceOption) *Service {
+	return NewService("orders", "", EndpointCodecMap{
+		"getOrder": MakeStandardEndpointCodec(func(_ context.Context, req getOrderRequest) (orderTotal, error) {
+			atomic.AddInt32(calls, 1)
+			if req.ID == "missing" {
+				return orderTotal{}, errOrderNotFound
+			}
+			return orderTotal{Total: float64(len(req.ID))}, nil
+		}, ""),
+		"cancelOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error {
+			atomic.AddInt32(calls, 1)
+			return nil
+		}, "", RequireScopes("orders:write")),
+	}, opts...)
+}
+
+func TestDoBatch(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, newBatchService(&calls, WithBatch(BatchOptions{Parallelism: 2})))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var first, second orderTotal
+	batch := []BatchCall{
+		{Method: "getOrder", Args: getOrderRequest{ID: "a"}, Result: &first},
+		{Method: "getOrder", Args: getOrderRequest{ID: "abc"}, Result: &second},
+		{Method: "getOrder", Args: getOrderRequest{ID: "missing"}, Result: &orderTotal{}},
+		{Method: "cancelOrder", Args: getOrderRequest{ID: "a"}},
+		{Method: "nope", Args: getOrderRequest{}},
+	}
+
+	if err := NewClient(srv.URL+"/rpc/orders").DoBatch(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]orderTotal{{Total: 1}, {Total: 3}}, []orderTotal{first, second}); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	if batch[0].Err != nil || batch[1].Err != nil {
+		t.Errorf("unexpected errors %v, %v", batch[0].Err, batch[1].Err)
+	}
+
+	for i, want := range map[int]Category{2: CategoryBadRequest, 3: CategoryUnauthorised, 4: CategoryNotFound} {
+		var rpcErr *Error
+		if !errors.As(batch[i].Err, &rpcErr) || rpcErr.Category != want {
+			t.Errorf("call %d: expected %q error, got %v", i, want, batch[i].Err)
+		}
+	}
+	if !errors.Is(batch[2].Err, errOrderNotFound) {
+		t.Errorf("expected order not found, got %v", batch[2].Err)
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 endpoint calls, got %d", calls)
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		opts       []ServiceOption
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "disabled",
+			body:       `[]`,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "too many calls",
+			opts:       []ServiceOption{WithBatch(BatchOptions{MaxItems: 1})},
+			body:       `[{"method":"getOrder"},{"method":"getOrder"}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not an array",
+			opts:       []ServiceOption{WithBatch(BatchOptions{})},
+			body:       `{"method":"getOrder"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			opts:       []ServiceOption{WithBatch(BatchOptions{MaxItems: 1}), WithDecodeOptions(DecodeOptions{MaxRequestSize: 16})},
+			body:       `[{"method":"getOrder","params":{"id":"1"}}]`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, newBatchService(&calls, tc.opts...))
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/orders", strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if calls != 0 {
+				t.Errorf("expected no endpoint calls, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestMetaBatch(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, newBatchService(&calls, WithBatch(BatchOptions{})))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc/orders", nil))
+
+	var meta Meta
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Batch {
+		t.Error("expected metadata to advertise batch")
+	}
+}
+
+func TestShareDeadlineHugeBudget(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodPost, "/rpc/orders", nil)
+	r.Header.Set("X-Request-Timeout", "9223372036854775807")
+	shareDeadline(r)
+
+	deadline, err := requestDeadline(r, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(deadline); d <= 0 || d > time.Second {
+		t.Errorf("expected deadline capped to method timeout, got %v", d)
+	}
+}
@@ -0,0 +1,265 @@
+package lokerpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrCircuitOpen is returned by Client.DoRequest without calling the server
+// while the circuit breaker is open.
+var ErrCircuitOpen = &Error{
+	Message:   "circuit breaker open",
+	Code:      "CIRCUIT_OPEN",
+	Namespace: "lokerpc",
+	Category:  CategoryUnavailable,
+}
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through.
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets a single probe call through, to decide whether to
+	// close or reopen.
+	CircuitHalfOpen
+	// CircuitOpen fails every call with ErrCircuitOpen.
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerPolicy configures a circuit breaker.
+type BreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// circuit. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before letting a probe
+	// through. Defaults to 30s.
+	OpenTimeout time.Duration
+	// PerMethod tracks each method separately, instead of the whole service.
+	PerMethod bool
+	// IsFailure reports whether an error counts towards opening the circuit.
+	// Defaults to transport errors, timeouts and 5xx responses. Calls
+	// cancelled by the caller are never counted.
+	IsFailure func(error) bool
+	// Registerer, if set, records state transitions with it.
+	Registerer prometheus.Registerer
+}
+
+// WithCircuitBreaker wraps calls in a circuit breaker, so a degraded service
+// isn't sent calls that are likely to fail. Each attempt made by a retry
+// policy counts separately. Copies of the Client share the breaker.
+func WithCircuitBreaker(p BreakerPolicy) ClientOption {
+	return func(c *Client) {
+		c.breakerPolicy = &p
+	}
+}
+
+type circuitBreaker struct {
+	policy  BreakerPolicy
+	service string
+	metrics *breakerMetrics
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// generation is incremented on every transition, so the outcomes of calls
+	// allowed in an earlier state can be ignored.
+	generation uint64
+}
+
+// breakerTicket is returned by allow for a call, and passed back to done
+// with its outcome.
+type breakerTicket struct {
+	generation uint64
+	probe      bool
+}
+
+func newCircuitBreaker(p BreakerPolicy, service string) *circuitBreaker {
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = 5
+	}
+	if p.OpenTimeout <= 0 {
+		p.OpenTimeout = 30 * time.Second
+	}
+	if p.IsFailure == nil {
+		p.IsFailure = isBreakerFailure
+	}
+
+	b := &circuitBreaker{
+		policy:   p,
+		service:  service,
+		circuits: map[string]*circuit{},
+	}
+	if p.Registerer != nil {
+		b.metrics = breakerMetricsFor(p.Registerer)
+	}
+
+	return b
+}
+
+// middleware guards each call with the breaker.
+func (b *circuitBreaker) middleware(next Invoker) Invoker {
+	return func(ctx context.Context, method string, args, result any) error {
+		t, ok := b.allow(method)
+		if !ok {
+			return ErrCircuitOpen
+		}
+		err := next(ctx, method, args, result)
+		b.done(method, t, err)
+		return err
+	}
+}
+
+func (b *circuitBreaker) key(method string) string {
+	if b.policy.PerMethod {
+		return method
+	}
+	return ""
+}
+
+// allow reports whether a call to method may go ahead. If it does, the
+// outcome must be passed to done along with the ticket.
+func (b *circuitBreaker) allow(method string) (breakerTicket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := b.key(method)
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	switch c.state {
+	case CircuitOpen:
+		if time.Since(c.openedAt) < b.policy.OpenTimeout {
+			return breakerTicket{}, false
+		}
+		b.transition(key, c, CircuitHalfOpen)
+		c.probing = true
+		return breakerTicket{generation: c.generation, probe: true}, true
+	case CircuitHalfOpen:
+		if c.probing {
+			return breakerTicket{}, false
+		}
+		c.probing = true
+		return breakerTicket{generation: c.generation, probe: true}, true
+	default:
+		return breakerTicket{generation: c.generation}, true
+	}
+}
+
+// done records the outcome of a call allowed by allow. Outcomes of calls
+// allowed before the circuit last changed state are ignored, so only the
+// probe decides whether a half-open circuit closes. Calls cancelled by the
+// caller say nothing about the server, so they leave the circuit as it is,
+// and a cancelled probe lets another through.
+func (b *circuitBreaker) done(method string, t breakerTicket, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := b.key(method)
+	c := b.circuits[key]
+	if t.generation != c.generation {
+		return
+	}
+	if t.probe {
+		c.probing = false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if err == nil || !b.policy.IsFailure(err) {
+		c.failures = 0
+		if c.state != CircuitClosed {
+			b.transition(key, c, CircuitClosed)
+		}
+		return
+	}
+
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= b.policy.FailureThreshold {
+		c.openedAt = time.Now()
+		if c.state != CircuitOpen {
+			b.transition(key, c, CircuitOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) transition(key string, c *circuit, state CircuitState) {
+	c.state = state
+	c.generation++
+	if b.metrics != nil {
+		b.metrics.state.WithLabelValues(b.service, key).Set(float64(state))
+		b.metrics.transitions.WithLabelValues(b.service, key, state.String()).Inc()
+	}
+}
+
+// isBreakerFailure is the default BreakerPolicy.IsFailure, which ignores
+// errors the server is not to blame for.
+func isBreakerFailure(err error) bool {
+	switch clientFailureType(err) {
+	case "transport", "timeout", "5xx":
+		return true
+	default:
+		return false
+	}
+}
+
+type breakerMetrics struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+}
+
+var (
+	breakerMetricsMu    sync.Mutex
+	breakerMetricsByReg = map[prometheus.Registerer]*breakerMetrics{}
+)
+
+// breakerMetricsFor returns the circuit breaker metrics registered with reg,
+// creating and registering them on first use.
+func breakerMetricsFor(reg prometheus.Registerer) *breakerMetrics {
+	breakerMetricsMu.Lock()
+	defer breakerMetricsMu.Unlock()
+
+	if m, ok := breakerMetricsByReg[reg]; ok {
+		return m
+	}
+
+	m := &breakerMetrics{
+		state: registerCollector(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_rpc_client_circuit_state",
+			Help: "State of rpc client circuit breakers, 0 closed, 1 half-open, 2 open",
+		}, []string{"service", "method"})),
+		transitions: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rpc_client_circuit_transitions_total",
+			Help: "The total number of rpc client circuit breaker state transitions",
+		}, []string{"service", "method", "state"})),
+	}
+	breakerMetricsByReg[reg] = m
+
+	return m
+}
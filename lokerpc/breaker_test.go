@@ -0,0 +1,239 @@
+package lokerpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newFlakyServer returns a server that responds to calls with the status
+// stored in status, and counts calls per method.
+func newFlakyServer(t *testing.T, status *int32, calls map[string]*int32) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls[strings.TrimPrefix(r.URL.Path, "/")], 1)
+
+		s := int(atomic.LoadInt32(status))
+		if s == http.StatusOK {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(s)
+		_ = json.NewEncoder(w).Encode(&Error{Message: http.StatusText(s)})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	status := int32(http.StatusInternalServerError)
+	var calls int32
+	srv := newFlakyServer(t, &status, map[string]*int32{"hello": &calls})
+
+	reg := prometheus.NewRegistry()
+	c := NewClient(srv.URL, WithClientMetrics(reg, "flaky"), WithCircuitBreaker(BreakerPolicy{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		Registerer:       reg,
+	}))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := c.DoRequest(ctx, "hello", deadlineRequest{}, nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected server error, got %v", err)
+		}
+	}
+
+	err := c.DoRequest(ctx, "hello", deadlineRequest{}, nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Category != CategoryUnavailable {
+		t.Errorf("expected unavailable *Error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected open circuit not to call the server, got %d calls", calls)
+	}
+
+	// After the timeout a probe is let through, which closes the circuit
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&status, http.StatusOK)
+
+	if err := c.DoRequest(ctx, "hello", deadlineRequest{}, nil); err != nil {
+		t.Fatalf("expected probe to succeed, got %v", err)
+	}
+	if err := c.DoRequest(ctx, "hello", deadlineRequest{}, nil); err != nil {
+		t.Fatalf("expected closed circuit, got %v", err)
+	}
+
+	m := breakerMetricsFor(reg)
+	for _, state := range []string{"open", "half-open", "closed"} {
+		if got := testutil.ToFloat64(m.transitions.WithLabelValues("flaky", "", state)); got != 1 {
+			t.Errorf("expected 1 transition to %s, got %v", state, got)
+		}
+	}
+	if got := testutil.ToFloat64(m.state.WithLabelValues("flaky", "")); got != float64(CircuitClosed) {
+		t.Errorf("expected closed state, got %v", got)
+	}
+
+	cm := clientMetricsFor(reg)
+	for typ, want := range map[string]float64{"5xx": 2, "circuit_open": 1} {
+		if got := testutil.ToFloat64(cm.failures.WithLabelValues("flaky", "hello", typ)); got != want {
+			t.Errorf("expected %v %s failures, got %v", want, typ, got)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
+	t.Parallel()
+
+	status := int32(http.StatusServiceUnavailable)
+	var calls int32
+	srv := newFlakyServer(t, &status, map[string]*int32{"hello": &calls})
+
+	c := NewClient(srv.URL, WithCircuitBreaker(BreakerPolicy{FailureThreshold: 1, OpenTimeout: 20 * time.Millisecond}))
+	ctx := context.Background()
+
+	_ = c.DoRequest(ctx, "hello", deadlineRequest{}, nil)
+	time.Sleep(30 * time.Millisecond)
+
+	// The probe fails, reopening the circuit
+	if err := c.DoRequest(ctx, "hello", deadlineRequest{}, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("expected probe to be let through")
+	}
+	if err := c.DoRequest(ctx, "hello", deadlineRequest{}, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to reopen, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestCircuitBreakerPerMethod(t *testing.T) {
+	t.Parallel()
+
+	status := int32(http.StatusInternalServerError)
+	var a, b int32
+	srv := newFlakyServer(t, &status, map[string]*int32{"a": &a, "b": &b})
+
+	c := NewClient(srv.URL, WithCircuitBreaker(BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Hour, PerMethod: true}))
+	ctx := context.Background()
+
+	_ = c.DoRequest(ctx, "a", deadlineRequest{}, nil)
+	if err := c.DoRequest(ctx, "a", deadlineRequest{}, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit for a to be open, got %v", err)
+	}
+	if err := c.DoRequest(ctx, "b", deadlineRequest{}, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("expected circuit for b to be closed")
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	t.Parallel()
+
+	status := int32(http.StatusBadRequest)
+	var calls int32
+	srv := newFlakyServer(t, &status, map[string]*int32{"hello": &calls})
+
+	c := NewClient(srv.URL, WithCircuitBreaker(BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Hour}))
+
+	for i := 0; i < 3; i++ {
+		if err := c.DoRequest(context.Background(), "hello", deadlineRequest{}, nil); errors.Is(err, ErrCircuitOpen) {
+			t.Fatal("expected 4xx responses not to open the circuit")
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresCancelledCalls(t *testing.T) {
+	t.Parallel()
+
+	b := newCircuitBreaker(BreakerPolicy{FailureThreshold: 2, OpenTimeout: time.Millisecond}, "cancel")
+	c := func() *circuit { return b.circuits[""] }
+
+	tk, _ := b.allow("hello")
+	b.done("hello", tk, errors.New("boom"))
+	tk, _ = b.allow("hello")
+	b.done("hello", tk, context.Canceled)
+	if c().failures != 1 {
+		t.Fatalf("expected cancelled call not to reset failures, got %d", c().failures)
+	}
+
+	tk, _ = b.allow("hello")
+	b.done("hello", tk, errors.New("boom"))
+	if c().state != CircuitOpen {
+		t.Fatalf("expected circuit to open, got %v", c().state)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	probe, ok := b.allow("hello")
+	if !ok || !probe.probe {
+		t.Fatal("expected a probe to be allowed")
+	}
+
+	// A cancelled probe neither closes the circuit nor blocks the next probe
+	b.done("hello", probe, fmt.Errorf("call: %w", context.Canceled))
+	if c().state != CircuitHalfOpen {
+		t.Fatalf("expected cancelled probe to leave circuit half open, got %v", c().state)
+	}
+	probe, ok = b.allow("hello")
+	if !ok || !probe.probe {
+		t.Fatal("expected another probe to be allowed")
+	}
+	b.done("hello", probe, errors.New("boom"))
+	if c().state != CircuitOpen {
+		t.Errorf("expected failed probe to reopen the circuit, got %v", c().state)
+	}
+}
+
+func TestCircuitBreakerIgnoresStaleOutcomes(t *testing.T) {
+	t.Parallel()
+
+	b := newCircuitBreaker(BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Millisecond}, "stale")
+	state := func() CircuitState { return b.circuits[""].state }
+
+	slow, _ := b.allow("hello")
+	fast, _ := b.allow("hello")
+	b.done("hello", fast, errors.New("boom"))
+	if state() != CircuitOpen {
+		t.Fatalf("expected circuit to open, got %v", state())
+	}
+
+	// A call that started before the circuit opened can't close it
+	b.done("hello", slow, nil)
+	if state() != CircuitOpen {
+		t.Fatalf("expected stale success to be ignored, got %v", state())
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	probe, ok := b.allow("hello")
+	if !ok || !probe.probe {
+		t.Fatal("expected a probe to be allowed")
+	}
+
+	// Nor can it let a second probe through while half open
+	b.done("hello", slow, nil)
+	if _, ok := b.allow("hello"); ok {
+		t.Error("expected a single probe while half open")
+	}
+
+	b.done("hello", probe, nil)
+	if state() != CircuitClosed {
+		t.Errorf("expected probe to close the circuit, got %v", state())
+	}
+}
@@ -5,82 +5,243 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/LOKE/pkg/requestid"
+	"github.com/LOKE/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewClient(baseURL string) Client {
-	return newClientWithClient(baseURL, http.DefaultClient)
+// NewClient creates a Client for the service at baseURL, e.g.
+// "http://orders/rpc/orders".
+func NewClient(baseURL string, opts ...ClientOption) Client {
+	c := newClientWithClient(baseURL, http.DefaultClient)
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.breakerPolicy != nil {
+		service := c.service
+		if service == "" {
+			service = c.bURL
+		}
+		c.breaker = newCircuitBreaker(*c.breakerPolicy, service)
+	}
+
+	return c
 }
 
 func newClientWithClient(baseURL string, client *http.Client) Client {
 	return Client{bURL: normalizeBaseURL(baseURL), client: client}
 }
 
-// NOTE: Maybe this should be exported, leaving it for now -- Dom
-type rpcClientError struct {
-	Message   string
-	Instance  string
-	Expose    bool
-	Code      string
-	Namespace string
-	Type      string
+type Client struct {
+	bURL   string
+	client *http.Client
+
+	header    http.Header
+	userAgent string
+	tokens    TokenSource
+
+	retry       RetryPolicy
+	methodRetry map[string]RetryPolicy
+
+	breakerPolicy *BreakerPolicy
+	breaker       *circuitBreaker
+
+	middleware []ClientMiddleware
+
+	service string
+	metrics *clientMetrics
 }
 
-func (e *rpcClientError) ErrorID() string {
-	return e.Instance
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// Invoker makes a call to method, decoding the response into result.
+type Invoker func(ctx context.Context, method string, args, result any) error
+
+// ClientMiddleware wraps an Invoker to add behaviour to outbound calls.
+type ClientMiddleware func(next Invoker) Invoker
+
+// WithClientMiddleware adds middleware to the client. The first middleware is
+// the outermost, and sees each call before any built in behaviour such as
+// retries.
+func WithClientMiddleware(mw ...ClientMiddleware) ClientOption {
+	return func(c *Client) {
+		c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], mw...)
+	}
 }
 
-func (e *rpcClientError) ErrorType() string {
-	return e.Type
+// TokenSource supplies bearer tokens for outbound calls.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
 }
 
-func (e *rpcClientError) Public() bool {
-	return e.Expose
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token calls f.
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
 }
 
-func (e *rpcClientError) Error() string {
-	return e.Message
-	// return fmt.Sprintf("RPC Error response: %s", e.Message)
+// StaticToken returns a TokenSource that always returns token.
+func StaticToken(token string) TokenSource {
+	return TokenSourceFunc(func(context.Context) (string, error) {
+		return token, nil
+	})
 }
 
-type Client struct {
-	bURL   string
-	client *http.Client
+// WithHTTPClient sets the http.Client used to make calls, e.g. to configure
+// the transport or TLS. Defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithHeader adds a header sent with every call. Headers used by the rpc
+// protocol itself, like Content-Type, can't be overridden.
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		if c.header == nil {
+			c.header = http.Header{}
+		}
+		c.header.Add(key, value)
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every call.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithBearerTokenSource sends a token from ts as a bearer token in the
+// Authorization header of every call.
+func WithBearerTokenSource(ts TokenSource) ClientOption {
+	return func(c *Client) {
+		c.tokens = ts
+	}
+}
+
+// WithClientMetrics records metrics for calls to service, registered with reg.
+func WithClientMetrics(reg prometheus.Registerer, service string) ClientOption {
+	return func(c *Client) {
+		c.service = service
+		c.metrics = clientMetricsFor(reg)
+	}
 }
 
 func normalizeBaseURL(baseURL string) string {
 	return strings.TrimRight(baseURL, "/") + "/"
 }
 
+// DoRequest calls method with args, decoding the response into result. The
+// call passes through the client's middleware, then tracing, metrics, retries
+// and the circuit breaker, in that order.
 func (c Client) DoRequest(ctx context.Context, method string, args, result any) error {
+	return c.invoker()(ctx, method, args, result)
+}
+
+// invoker builds the middleware chain around doRequest.
+func (c Client) invoker() Invoker {
+	inv := Invoker(c.doRequest)
+
+	if c.breaker != nil {
+		inv = c.breaker.middleware(inv)
+	}
+	inv = c.retryMiddleware(inv)
+	if c.metrics != nil {
+		inv = c.metrics.middleware(c.service)(inv)
+	}
+	inv = tracingMiddleware(c.bURL)(inv)
+
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		inv = c.middleware[i](inv)
+	}
+
+	return inv
+}
+
+func tracingMiddleware(baseURL string) ClientMiddleware {
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, result any) error {
+			ctx, span := tracing.Start(ctx, method, tracing.KindClient)
+			defer span.End()
+			span.SetAttribute("rpc.url", baseURL+method)
+
+			err := next(ctx, method, args, result)
+			if err != nil {
+				span.SetError(err)
+			}
+			return err
+		}
+	}
+}
+
+func (c Client) doRequest(ctx context.Context, method string, args, result any) error {
+	return c.post(ctx, c.bURL+method, args, result)
+}
+
+// post sends args to url, decoding the response into result.
+func (c Client) post(ctx context.Context, url string, args, result any) error {
 	b := new(bytes.Buffer)
 	if err := json.NewEncoder(b).Encode(args); err != nil {
 		return err
 	}
 
-	url := c.bURL + method
 	req, err := http.NewRequest("POST", url, b)
 	if err != nil {
 		return err
 	}
 
+	for k, vs := range c.header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	if c.tokens != nil {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("Error getting rpc bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
 	req.Header.Set("Content-Type", "application/json")
 
 	if reqID, ok := requestid.FromContext(ctx); ok {
 		req.Header.Set("X-Request-ID", reqID.String())
 	}
 
+	tracing.Inject(ctx, req.Header)
+
 	if deadline, ok := ctx.Deadline(); ok {
 		// Could probably also use .Format(time.RFC3339Nano), but MarshalJSON
 		// seems to do more, and I think it'll be safer for JS
 		b, err := deadline.MarshalJSON()
-		if err != nil {
+		if err == nil {
 			// string(b[1:len(b)-1]) strips the quotes from the value
 			req.Header.Set("X-Request-Deadline", string(b[1:len(b)-1]))
 		}
+
+		// The remaining budget isn't affected by clock skew between hosts, so
+		// servers prefer it over the absolute deadline
+		budget := time.Until(deadline).Milliseconds()
+		if budget < 0 {
+			budget = 0
+		}
+		req.Header.Set("X-Request-Timeout", strconv.FormatInt(budget, 10))
 	}
 
 	req = req.WithContext(ctx)
@@ -101,15 +262,47 @@ func (c Client) DoRequest(ctx context.Context, method string, args, result any)
 		}
 	case http.StatusNoContent:
 		return nil
-	case http.StatusNotFound:
-		return fmt.Errorf("Error rpc method not found: %v", url)
 	default:
-		err := &rpcClientError{}
+		// Endpoints can return structured not found errors, anything else is
+		// from the mux, ie the method doesn't exist
+		if res.StatusCode == http.StatusNotFound && !strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+			return &Error{
+				Message:  fmt.Sprintf("Error rpc method not found: %v", url),
+				Category: CategoryNotFound,
+			}
+		}
+
+		err := &Error{}
 		jsonErr := json.NewDecoder(res.Body).Decode(err)
 		if jsonErr != nil {
-			return fmt.Errorf("Error decoding rpc error response: %v", jsonErr)
+			return &Error{
+				Message:  fmt.Sprintf("Error decoding rpc error response: %v", jsonErr),
+				Category: CategoryFromStatus(res.StatusCode),
+			}
+		}
+		err.Category = CategoryFromStatus(res.StatusCode)
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable {
+			err.retryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
 		}
 		return err
 	}
 	return nil
 }
+
+// parseRetryAfter parses a Retry-After header, given as either seconds or an
+// HTTP date, returning zero if it's missing or invalid.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs <= 0 || secs > int64(math.MaxInt64/time.Second) {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
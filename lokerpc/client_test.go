@@ -1,8 +1,19 @@
 package lokerpc
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/LOKE/pkg/tracing"
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNewClientNormalizesBaseURL(t *testing.T) {
@@ -42,3 +53,274 @@ func TestNewClientNormalizesBaseURL(t *testing.T) {
 		})
 	}
 }
+
+func TestClientPropagatesDeadline(t *testing.T) {
+	t.Parallel()
+
+	type headers struct {
+		deadline string
+		timeout  string
+	}
+
+	var (
+		got     time.Time
+		hasDead bool
+		sent    headers
+	)
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("deadline", "", EndpointCodecMap{
+		"wait": MakeVoidEndpointCodec(func(ctx context.Context, _ deadlineRequest) error {
+			got, hasDead = ctx.Deadline()
+			return nil
+		}, ""),
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = headers{r.Header.Get("X-Request-Deadline"), r.Header.Get("X-Request-Timeout")}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want, _ := ctx.Deadline()
+
+	if err := NewClient(srv.URL+"/rpc/deadline").DoRequest(ctx, "wait", deadlineRequest{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.deadline == "" {
+		t.Error("expected X-Request-Deadline to be sent")
+	}
+	if sent.timeout == "" {
+		t.Error("expected X-Request-Timeout to be sent")
+	}
+	if !hasDead {
+		t.Fatal("expected endpoint context to have a deadline")
+	}
+	if diff := want.Sub(got); diff < -100*time.Millisecond || diff > 100*time.Millisecond {
+		t.Errorf("expected server deadline %v to match caller deadline %v", got, want)
+	}
+}
+
+func TestClientPropagatesTrace(t *testing.T) {
+	t.Parallel()
+
+	var (
+		traceparent string
+		serverSC    tracing.SpanContext
+	)
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("trace", "", EndpointCodecMap{
+		"hello": MakeVoidEndpointCodec(func(ctx context.Context, _ deadlineRequest) error {
+			serverSC, _ = tracing.FromContext(ctx)
+			return nil
+		}, ""),
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	exp := &tracing.InMemoryExporter{}
+	ctx, root := tracing.NewTracer(exp).Start(context.Background(), "root", tracing.KindInternal)
+
+	if err := NewClient(srv.URL+"/rpc/trace").DoRequest(ctx, "hello", deadlineRequest{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected client and root spans, got %d", len(spans))
+	}
+	client := spans[0]
+
+	if client.Kind != tracing.KindClient || client.ParentSpanID != root.SpanContext().SpanID {
+		t.Errorf("expected client span to be a child of root, got %+v", client)
+	}
+	if traceparent != client.SpanContext.Traceparent() {
+		t.Errorf("expected traceparent %q, got %q", client.SpanContext.Traceparent(), traceparent)
+	}
+	if serverSC.TraceID != root.SpanContext().TraceID {
+		t.Errorf("expected server span in trace %s, got %s", root.SpanContext().TraceID, serverSC.TraceID)
+	}
+	if serverSC.SpanID == client.SpanContext.SpanID {
+		t.Error("expected server to start its own span")
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("clientmetrics", "", EndpointCodecMap{
+		"ok": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error { return nil }, ""),
+		"missing": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error {
+			return &Error{Message: "missing", Category: CategoryNotFound}
+		}, ""),
+		"broken": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error {
+			return &Error{Message: "broken", Category: CategoryInternal}
+		}, ""),
+		"slow": MakeVoidEndpointCodec(func(ctx context.Context, _ deadlineRequest) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, ""),
+	}))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	c := NewClient(srv.URL+"/rpc/clientmetrics", WithClientMetrics(reg, "clientmetrics"))
+
+	for _, method := range []string{"ok", "missing", "broken"} {
+		_ = c.DoRequest(context.Background(), method, deadlineRequest{}, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_ = c.DoRequest(ctx, "slow", deadlineRequest{}, nil)
+
+	unreachable := NewClient("http://127.0.0.1:1/rpc/clientmetrics", WithClientMetrics(reg, "clientmetrics"))
+	_ = unreachable.DoRequest(context.Background(), "ok", deadlineRequest{}, nil)
+
+	m := clientMetricsFor(reg)
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("clientmetrics", "ok")); got != 2 {
+		t.Errorf("expected 2 calls to ok, got %v", got)
+	}
+
+	wantFailures := []struct {
+		method, failureType string
+	}{
+		{"missing", "4xx"},
+		{"broken", "5xx"},
+		{"slow", "timeout"},
+		{"ok", "transport"},
+	}
+	for _, w := range wantFailures {
+		if got := testutil.ToFloat64(m.failures.WithLabelValues("clientmetrics", w.method, w.failureType)); got != 1 {
+			t.Errorf("expected 1 %s failure for %s, got %v", w.failureType, w.method, got)
+		}
+	}
+	if n := testutil.CollectAndCount(m.failures); n != len(wantFailures) {
+		t.Errorf("expected %d failure series, got %d", len(wantFailures), n)
+	}
+}
+
+type countingTransport struct {
+	n int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.n++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClientOptions(t *testing.T) {
+	t.Parallel()
+
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	c := NewClient(srv.URL,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithHeader("X-Tenant", "loke"),
+		WithHeader("Content-Type", "text/plain"),
+		WithUserAgent("orders/1.0"),
+		WithBearerTokenSource(StaticToken("secret")),
+	)
+
+	if err := c.DoRequest(context.Background(), "hello", deadlineRequest{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if transport.n != 1 {
+		t.Errorf("expected custom http client to be used")
+	}
+
+	want := map[string]string{
+		"X-Tenant":      "loke",
+		"Content-Type":  "application/json",
+		"User-Agent":    "orders/1.0",
+		"Authorization": "Bearer secret",
+	}
+	for k, v := range want {
+		if got.Get(k) != v {
+			t.Errorf("expected header %s %q, got %q", k, v, got.Get(k))
+		}
+	}
+}
+
+func TestClientTokenSourceError(t *testing.T) {
+	t.Parallel()
+
+	c := NewClient("http://127.0.0.1:1", WithBearerTokenSource(TokenSourceFunc(func(context.Context) (string, error) {
+		return "", errors.New("no token")
+	})))
+
+	err := c.DoRequest(context.Background(), "hello", deadlineRequest{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "no token") {
+		t.Errorf("expected token error, got %v", err)
+	}
+}
+
+func TestClientMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"from-server"}`))
+	}))
+	defer srv.Close()
+
+	var order []string
+	record := func(name string) ClientMiddleware {
+		return func(next Invoker) Invoker {
+			return func(ctx context.Context, method string, args, result any) error {
+				order = append(order, name+":"+method)
+				return next(ctx, method, args, result)
+			}
+		}
+	}
+	cache := func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, result any) error {
+			if req, ok := args.(getOrderRequest); ok && req.ID == "cached" {
+				*result.(*getOrderRequest) = getOrderRequest{ID: "from-cache"}
+				return nil
+			}
+			return next(ctx, method, args, result)
+		}
+	}
+
+	c := NewClient(srv.URL, WithClientMiddleware(record("first"), record("second")), WithClientMiddleware(cache))
+
+	var res getOrderRequest
+	if err := c.DoRequest(context.Background(), "getOrder", getOrderRequest{ID: "cached"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != "from-cache" || calls != 0 {
+		t.Errorf("expected cached response without a call, got %q after %d calls", res.ID, calls)
+	}
+
+	if err := c.DoRequest(context.Background(), "getOrder", getOrderRequest{ID: "1"}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != "from-server" || calls != 1 {
+		t.Errorf("expected server response, got %q after %d calls", res.ID, calls)
+	}
+
+	want := []string{"first:getOrder", "second:getOrder", "first:getOrder", "second:getOrder"}
+	if diff := cmp.Diff(want, order); diff != "" {
+		t.Errorf("middleware order mismatch (-want +got):\n%s", diff)
+	}
+}
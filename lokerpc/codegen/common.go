@@ -5,6 +5,9 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/LOKE/pkg/lokerpc"
+	jtd "github.com/jsontypedef/json-typedef-go"
 )
 
 func capitalize(s string) string {
@@ -39,3 +42,54 @@ func quoteFieldNames(s string) string {
 	}
 	return fmt.Sprintf("%q", s)
 }
+
+// scopesNote describes the scopes a method requires, for its doc comment.
+func scopesNote(v lokerpc.EndpointMeta) string {
+	if len(v.Scopes) == 0 {
+		return ""
+	}
+	return "requires the scopes: " + strings.Join(v.Scopes, ", ")
+}
+
+// positionalParam is a request param of a method called with positional
+// params.
+type positionalParam struct {
+	name     string
+	schema   jtd.Schema
+	optional bool
+}
+
+// positionalParams returns the params of a MultiArg method, in the order of
+// its ParamNames. It returns false if the method doesn't take positional
+// params, or if any of them can't be found in its request type, in which case
+// it is called with the request type as usual.
+func positionalParams(meta lokerpc.Meta, v lokerpc.EndpointMeta) ([]positionalParam, bool) {
+	if !(meta.MultiArg || v.MultiArg) || v.RequestTypeDef == nil || len(v.ParamNames) == 0 {
+		return nil, false
+	}
+
+	schema := *v.RequestTypeDef
+	if schema.Ref != nil {
+		def, ok := meta.Definitions[*schema.Ref]
+		if !ok {
+			return nil, false
+		}
+		schema = def
+	}
+	if schema.Form() != jtd.FormProperties {
+		return nil, false
+	}
+
+	params := make([]positionalParam, 0, len(v.ParamNames))
+	for _, name := range v.ParamNames {
+		if s, ok := schema.Properties[name]; ok {
+			params = append(params, positionalParam{name: name, schema: s})
+		} else if s, ok := schema.OptionalProperties[name]; ok {
+			params = append(params, positionalParam{name: name, schema: s, optional: true})
+		} else {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
@@ -3,6 +3,7 @@ package codegen
 import (
 	"bytes"
 	"fmt"
+	"go/token"
 	"io"
 	"regexp"
 	"strings"
@@ -82,16 +83,53 @@ type resolvedMethod struct {
 	reqType string
 	resType string
 	isVoid  bool
+
+	// params are the request params of the method signature, paramTypes
+	// their types alone, and args the value passed to DoRequest, built by the
+	// argsStmt statements if set.
+	params     string
+	paramTypes string
+	args       string
+	argsStmt   string
 }
 
 // resolveMethodTypes determines the Go request and response types for an endpoint,
 // including whether the method has a void return type.
-func resolveMethodTypes(v lokerpc.EndpointMeta, imports map[string]struct{}) resolvedMethod {
+func resolveMethodTypes(meta lokerpc.Meta, v lokerpc.EndpointMeta, imports map[string]struct{}) resolvedMethod {
 	reqType := "any"
 	if v.RequestTypeDef != nil {
 		reqType = GenGoType(*v.RequestTypeDef, imports)
 	}
 
+	m := resolvedMethod{
+		reqType:    reqType,
+		params:     "req " + reqType,
+		paramTypes: reqType,
+		args:       "req",
+	}
+
+	if pps, ok := positionalParams(meta, v); ok {
+		var params, types, args []string
+		for _, p := range pps {
+			name := goParamName(p.name)
+			typ := GenGoType(p.schema, imports)
+			if p.optional {
+				typ = goOptionalType(typ)
+			}
+			params = append(params, name+" "+typ)
+			types = append(types, typ)
+			args = append(args, name)
+		}
+		m.params = strings.Join(params, ", ")
+		m.paramTypes = strings.Join(types, ", ")
+		m.args = "[]any{" + strings.Join(args, ", ") + "}"
+
+		if stmt := goTrimArgs(pps, args); stmt != "" {
+			m.argsStmt = "\targs := " + m.args + "\n" + stmt
+			m.args = "args"
+		}
+	}
+
 	resType := "any"
 	isVoid := false
 	if v.ResponseTypeDef != nil {
@@ -107,7 +145,70 @@ func resolveMethodTypes(v lokerpc.EndpointMeta, imports map[string]struct{}) res
 		}
 	}
 
-	return resolvedMethod{reqType: reqType, resType: resType, isVoid: isVoid}
+	m.resType = resType
+	m.isVoid = isVoid
+
+	return m
+}
+
+// goOptionalType returns the type of an optional positional param, which is
+// nil when the param is omitted.
+func goOptionalType(typ string) string {
+	if typ == "any" || strings.HasPrefix(typ, "*") || strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") {
+		return typ
+	}
+	return "*" + typ
+}
+
+// goTrimArgs returns statements that drop the trailing optional params that
+// are nil from args, so they are omitted rather than sent as null.
+func goTrimArgs(pps []positionalParam, args []string) string {
+	required := len(pps)
+	for required > 0 && pps[required-1].optional {
+		required--
+	}
+
+	var b strings.Builder
+	switch optional := len(pps) - required; {
+	case optional == 0:
+		return ""
+	case optional == 1:
+		fmt.Fprintf(&b, "\tif %s == nil {\n", args[required])
+		fmt.Fprintf(&b, "\t\targs = args[:%d]\n", required)
+		fmt.Fprintf(&b, "\t}\n")
+	default:
+		fmt.Fprintf(&b, "\tswitch {\n")
+		for i := len(args) - 1; i >= required; i-- {
+			fmt.Fprintf(&b, "\tcase %s != nil:\n", args[i])
+			if i+1 < len(args) {
+				fmt.Fprintf(&b, "\t\targs = args[:%d]\n", i+1)
+			}
+		}
+		fmt.Fprintf(&b, "\tdefault:\n")
+		fmt.Fprintf(&b, "\t\targs = args[:%d]\n", required)
+		fmt.Fprintf(&b, "\t}\n")
+	}
+	return b.String()
+}
+
+// goParamName returns the Go identifier for a positional param, avoiding
+// keywords and the names used in generated methods.
+func goParamName(name string) string {
+	n := goFieldName(name)
+	if strings.ToUpper(n) == n {
+		n = strings.ToLower(n)
+	} else {
+		n = strings.ToLower(n[:1]) + n[1:]
+	}
+
+	switch n {
+	case "c", "ctx", "cancel", "res", "err", "args":
+		return n + "_"
+	}
+	if token.IsKeyword(n) {
+		return n + "_"
+	}
+	return n
 }
 
 func GenGoClient(w io.Writer, meta lokerpc.Meta) error {
@@ -129,13 +230,13 @@ func GenGoClient(w io.Writer, meta lokerpc.Meta) error {
 	// goDocComment(b, meta.Help, "")
 	b.WriteString("type " + goFieldName(meta.ServiceName) + "Service interface {\n")
 	for _, v := range meta.Interfaces {
-		m := resolveMethodTypes(v, imports)
+		m := resolveMethodTypes(meta, v, imports)
 
 		// goDocComment(b, v.Help, "\t")
 		if m.isVoid {
-			fmt.Fprintf(&b, "\t%s(context.Context, %s) error\n", goFieldName(v.MethodName), m.reqType)
+			fmt.Fprintf(&b, "\t%s(context.Context, %s) error\n", goFieldName(v.MethodName), m.paramTypes)
 		} else {
-			fmt.Fprintf(&b, "\t%s(context.Context, %s) (%s, error)\n", goFieldName(v.MethodName), m.reqType, m.resType)
+			fmt.Fprintf(&b, "\t%s(context.Context, %s) (%s, error)\n", goFieldName(v.MethodName), m.paramTypes, m.resType)
 		}
 	}
 	b.WriteString("}\n")
@@ -145,11 +246,16 @@ func GenGoClient(w io.Writer, meta lokerpc.Meta) error {
 	// goDocComment(b, meta.Help, "")
 	b.WriteString("type " + goFieldName(meta.ServiceName) + "RPCClient struct{\nlokerpc.Client}\n\n")
 	for _, v := range meta.Interfaces {
-		m := resolveMethodTypes(v, imports)
+		m := resolveMethodTypes(meta, v, imports)
 
+		if note := scopesNote(v); note != "" {
+			fmt.Fprintf(&b, "// %s %s\n", goFieldName(v.MethodName), note)
+		}
 		if m.isVoid {
-			fmt.Fprintf(&b, "func (c %sRPCClient) %s(ctx context.Context, req %s) error {\n", goFieldName(meta.ServiceName), goFieldName(v.MethodName), m.reqType)
-			fmt.Fprintf(&b, "\treturn c.DoRequest(ctx, \"%s\", req, nil)\n", v.MethodName)
+			fmt.Fprintf(&b, "func (c %sRPCClient) %s(ctx context.Context, %s) error {\n", goFieldName(meta.ServiceName), goFieldName(v.MethodName), m.params)
+			goMethodTimeout(&b, v, imports)
+			b.WriteString(m.argsStmt)
+			fmt.Fprintf(&b, "\treturn c.DoRequest(%s, \"%s\", %s, nil)\n", goCallCtx(v), v.MethodName, m.args)
 			fmt.Fprintf(&b, "}\n")
 		} else {
 			varType := m.resType
@@ -157,9 +263,11 @@ func GenGoClient(w io.Writer, meta lokerpc.Meta) error {
 				varType = varType[1:]
 			}
 
-			fmt.Fprintf(&b, "func (c %sRPCClient) %s(ctx context.Context, req %s) (%s, error) {\n", goFieldName(meta.ServiceName), goFieldName(v.MethodName), m.reqType, m.resType)
+			fmt.Fprintf(&b, "func (c %sRPCClient) %s(ctx context.Context, %s) (%s, error) {\n", goFieldName(meta.ServiceName), goFieldName(v.MethodName), m.params, m.resType)
+			goMethodTimeout(&b, v, imports)
+			b.WriteString(m.argsStmt)
 			fmt.Fprintf(&b, "\tvar res %s\n", varType)
-			fmt.Fprintf(&b, "\terr := c.DoRequest(ctx, \"%s\", req, &res)\n", v.MethodName)
+			fmt.Fprintf(&b, "\terr := c.DoRequest(%s, \"%s\", %s, &res)\n", goCallCtx(v), v.MethodName, m.args)
 			fmt.Fprintf(&b, "\tif err != nil {\n")
 			fmt.Fprintf(&b, "\t\treturn nil, err\n")
 			fmt.Fprintf(&b, "\t}\n")
@@ -172,6 +280,10 @@ func GenGoClient(w io.Writer, meta lokerpc.Meta) error {
 			}
 			fmt.Fprintf(&b, "}\n")
 		}
+
+		if meta.Batch {
+			goBatchCall(&b, meta, v, m)
+		}
 	}
 
 	// Write header
@@ -189,6 +301,47 @@ func GenGoClient(w io.Writer, meta lokerpc.Meta) error {
 	return err
 }
 
+// goMethodTimeout writes a context timeout matching the method timeout the
+// server advertises, so calls aren't left waiting after the server gives up.
+func goMethodTimeout(w io.Writer, v lokerpc.EndpointMeta, imports map[string]struct{}) {
+	if v.MethodTimeout <= 0 {
+		return
+	}
+	imports["time"] = struct{}{}
+	fmt.Fprintf(w, "\tctx, cancel := context.WithTimeout(ctx, %d*time.Millisecond)\n", v.MethodTimeout)
+	fmt.Fprintf(w, "\tdefer cancel()\n")
+}
+
+// goBatchCall writes a constructor for a lokerpc.BatchCall to the method, for
+// use with DoBatch.
+func goBatchCall(w io.Writer, meta lokerpc.Meta, v lokerpc.EndpointMeta, m resolvedMethod) {
+	name := goFieldName(v.MethodName)
+	fmt.Fprintf(w, "\n// %sCall returns a call to %s for use with DoBatch.\n", name, name)
+	if m.isVoid {
+		fmt.Fprintf(w, "func (c %sRPCClient) %sCall(%s) lokerpc.BatchCall {\n", goFieldName(meta.ServiceName), name, m.params)
+		io.WriteString(w, m.argsStmt)
+		fmt.Fprintf(w, "\treturn lokerpc.BatchCall{Method: \"%s\", Args: %s}\n", v.MethodName, m.args)
+	} else {
+		resType := m.resType
+		if !strings.HasPrefix(resType, "*") {
+			resType = "*" + resType
+		}
+		fmt.Fprintf(w, "func (c %sRPCClient) %sCall(%s, res %s) lokerpc.BatchCall {\n", goFieldName(meta.ServiceName), name, m.params, resType)
+		io.WriteString(w, m.argsStmt)
+		fmt.Fprintf(w, "\treturn lokerpc.BatchCall{Method: \"%s\", Args: %s, Result: res}\n", v.MethodName, m.args)
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// goCallCtx returns the context expression to call an endpoint with, marking
+// idempotent methods so the client may retry them.
+func goCallCtx(v lokerpc.EndpointMeta) string {
+	if v.Idempotent {
+		return "lokerpc.MarkIdempotent(ctx)"
+	}
+	return "ctx"
+}
+
 // Regexp that matches word boundaries,
 // e.g.
 // "customer_id" -> "CustomerID"
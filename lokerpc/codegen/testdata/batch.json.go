@@ -0,0 +1,55 @@
+package orders
+
+import (
+	"context"
+	"time"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+type GetOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type GetOrderResponse struct {
+	Total float64 `json:"total"`
+}
+
+type CancelOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type OrdersService interface {
+	GetOrder(context.Context, GetOrderRequest) (*GetOrderResponse, error)
+	CancelOrder(context.Context, CancelOrderRequest) error
+}
+
+type OrdersRPCClient struct {
+	lokerpc.Client
+}
+
+func (c OrdersRPCClient) GetOrder(ctx context.Context, req GetOrderRequest) (*GetOrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	var res GetOrderResponse
+	err := c.DoRequest(ctx, "getOrder", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetOrderCall returns a call to GetOrder for use with DoBatch.
+func (c OrdersRPCClient) GetOrderCall(req GetOrderRequest, res *GetOrderResponse) lokerpc.BatchCall {
+	return lokerpc.BatchCall{Method: "getOrder", Args: req, Result: res}
+}
+func (c OrdersRPCClient) CancelOrder(ctx context.Context, req CancelOrderRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	return c.DoRequest(ctx, "cancelOrder", req, nil)
+}
+
+// CancelOrderCall returns a call to CancelOrder for use with DoBatch.
+func (c OrdersRPCClient) CancelOrderCall(req CancelOrderRequest) lokerpc.BatchCall {
+	return lokerpc.BatchCall{Method: "cancelOrder", Args: req}
+}
@@ -2,6 +2,7 @@ package typed
 
 import (
 	"context"
+	"time"
 
 	"github.com/LOKE/pkg/lokerpc"
 )
@@ -31,6 +32,8 @@ type TypedRPCClient struct {
 }
 
 func (c TypedRPCClient) GetUser(ctx context.Context, req GetUserRequest_) (*GetUserResponse_, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
 	var res GetUserResponse_
 	err := c.DoRequest(ctx, "getUser", req, &res)
 	if err != nil {
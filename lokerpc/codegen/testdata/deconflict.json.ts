@@ -1,5 +1,5 @@
 import { RPCContextClient } from "@loke/http-rpc-client";
-import { Context } from "@loke/context";
+import { Context, withTimeout } from "@loke/context";
 
 export type GetUserRequest = {
   name: string;
@@ -28,6 +28,7 @@ export class TypedService extends RPCContextClient {
    * hello1 method
    */
   getUser(ctx: Context, req: GetUserRequest_): Promise<GetUserResponse_> {
-    return this.request(ctx, "getUser", req);
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getUser", req).finally(abort);
   }
 }
@@ -0,0 +1,64 @@
+package orders
+
+import (
+	"context"
+	"time"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+type GetOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type GetOrderResponse struct {
+	Total float64 `json:"total"`
+}
+
+type CancelOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type PlaceOrderRequest struct {
+	Total float64 `json:"total"`
+}
+
+type PlaceOrderResponse struct {
+	ID string `json:"id"`
+}
+
+type OrdersService interface {
+	GetOrder(context.Context, GetOrderRequest) (*GetOrderResponse, error)
+	CancelOrder(context.Context, CancelOrderRequest) error
+	PlaceOrder(context.Context, PlaceOrderRequest) (*PlaceOrderResponse, error)
+}
+
+type OrdersRPCClient struct {
+	lokerpc.Client
+}
+
+func (c OrdersRPCClient) GetOrder(ctx context.Context, req GetOrderRequest) (*GetOrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5000*time.Millisecond)
+	defer cancel()
+	var res GetOrderResponse
+	err := c.DoRequest(lokerpc.MarkIdempotent(ctx), "getOrder", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+func (c OrdersRPCClient) CancelOrder(ctx context.Context, req CancelOrderRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	return c.DoRequest(lokerpc.MarkIdempotent(ctx), "cancelOrder", req, nil)
+}
+func (c OrdersRPCClient) PlaceOrder(ctx context.Context, req PlaceOrderRequest) (*PlaceOrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	var res PlaceOrderResponse
+	err := c.DoRequest(ctx, "placeOrder", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
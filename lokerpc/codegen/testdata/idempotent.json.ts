@@ -0,0 +1,52 @@
+import { RPCContextClient } from "@loke/http-rpc-client";
+import { Context, withTimeout } from "@loke/context";
+
+export type GetOrderRequest = {
+  id: string;
+};
+
+export type GetOrderResponse = {
+  total: number;
+};
+
+export type CancelOrderRequest = {
+  id: string;
+};
+
+export type PlaceOrderRequest = {
+  total: number;
+};
+
+export type PlaceOrderResponse = {
+  id: string;
+};
+
+/**
+ * 
+ */
+export class OrdersService extends RPCContextClient {
+  constructor(baseUrl: string) {
+    super(baseUrl, "orders")
+  }
+  /**
+   * get an order
+   */
+  getOrder(ctx: Context, req: GetOrderRequest): Promise<GetOrderResponse> {
+    const [tctx, abort] = withTimeout(ctx, 5000);
+    return this.request(tctx, "getOrder", req).finally(abort);
+  }
+  /**
+   * cancel an order
+   */
+  cancelOrder(ctx: Context, req: CancelOrderRequest): Promise<void> {
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "cancelOrder", req).finally(abort);
+  }
+  /**
+   * place an order
+   */
+  placeOrder(ctx: Context, req: PlaceOrderRequest): Promise<PlaceOrderResponse> {
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "placeOrder", req).finally(abort);
+  }
+}
@@ -0,0 +1,122 @@
+package orders
+
+import (
+	"context"
+	"time"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+type PlaceOrderRequest struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Note string `json:"note,omitempty"`
+}
+
+type PlaceOrderResponse struct {
+	Total float64 `json:"total"`
+}
+
+type UpdateOrderRequest struct {
+	ID       string `json:"id"`
+	Note     string `json:"note,omitempty"`
+	Priority int32  `json:"priority,omitempty"`
+}
+
+type CancelOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type GetOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type GetOrderResponse struct {
+	Total float64 `json:"total"`
+}
+
+type OrdersService interface {
+	PlaceOrder(context.Context, string, string, *string) (*PlaceOrderResponse, error)
+	UpdateOrder(context.Context, string, *string, *int32) error
+	CancelOrder(context.Context, string) error
+	GetOrder(context.Context, GetOrderRequest) (*GetOrderResponse, error)
+}
+
+type OrdersRPCClient struct {
+	lokerpc.Client
+}
+
+func (c OrdersRPCClient) PlaceOrder(ctx context.Context, id string, type_ string, note *string) (*PlaceOrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	args := []any{id, type_, note}
+	if note == nil {
+		args = args[:2]
+	}
+	var res PlaceOrderResponse
+	err := c.DoRequest(ctx, "placeOrder", args, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PlaceOrderCall returns a call to PlaceOrder for use with DoBatch.
+func (c OrdersRPCClient) PlaceOrderCall(id string, type_ string, note *string, res *PlaceOrderResponse) lokerpc.BatchCall {
+	args := []any{id, type_, note}
+	if note == nil {
+		args = args[:2]
+	}
+	return lokerpc.BatchCall{Method: "placeOrder", Args: args, Result: res}
+}
+func (c OrdersRPCClient) UpdateOrder(ctx context.Context, id string, note *string, priority *int32) error {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	args := []any{id, note, priority}
+	switch {
+	case priority != nil:
+	case note != nil:
+		args = args[:2]
+	default:
+		args = args[:1]
+	}
+	return c.DoRequest(ctx, "updateOrder", args, nil)
+}
+
+// UpdateOrderCall returns a call to UpdateOrder for use with DoBatch.
+func (c OrdersRPCClient) UpdateOrderCall(id string, note *string, priority *int32) lokerpc.BatchCall {
+	args := []any{id, note, priority}
+	switch {
+	case priority != nil:
+	case note != nil:
+		args = args[:2]
+	default:
+		args = args[:1]
+	}
+	return lokerpc.BatchCall{Method: "updateOrder", Args: args}
+}
+func (c OrdersRPCClient) CancelOrder(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	return c.DoRequest(ctx, "cancelOrder", []any{id}, nil)
+}
+
+// CancelOrderCall returns a call to CancelOrder for use with DoBatch.
+func (c OrdersRPCClient) CancelOrderCall(id string) lokerpc.BatchCall {
+	return lokerpc.BatchCall{Method: "cancelOrder", Args: []any{id}}
+}
+func (c OrdersRPCClient) GetOrder(ctx context.Context, req GetOrderRequest) (*GetOrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	var res GetOrderResponse
+	err := c.DoRequest(ctx, "getOrder", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetOrderCall returns a call to GetOrder for use with DoBatch.
+func (c OrdersRPCClient) GetOrderCall(req GetOrderRequest, res *GetOrderResponse) lokerpc.BatchCall {
+	return lokerpc.BatchCall{Method: "getOrder", Args: req, Result: res}
+}
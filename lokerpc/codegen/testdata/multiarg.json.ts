@@ -0,0 +1,75 @@
+import { RPCContextClient } from "@loke/http-rpc-client";
+import { Context, withTimeout } from "@loke/context";
+
+export type PlaceOrderRequest = {
+  id: string;
+  type: string;
+  note?: string;
+};
+
+export type PlaceOrderResponse = {
+  total: number;
+};
+
+export type UpdateOrderRequest = {
+  id: string;
+  note?: string;
+  priority?: number;
+};
+
+export type CancelOrderRequest = {
+  id: string;
+};
+
+export type GetOrderRequest = {
+  id: string;
+};
+
+export type GetOrderResponse = {
+  total: number;
+};
+
+/**
+ * 
+ */
+export class OrdersService extends RPCContextClient {
+  constructor(baseUrl: string) {
+    super(baseUrl, "orders")
+  }
+  /**
+   * place an order
+   */
+  placeOrder(ctx: Context, id: string, type: string, note?: string): Promise<PlaceOrderResponse> {
+    const args = [id, type, note];
+    while (args.length > 2 && args[args.length - 1] === undefined) {
+      args.pop();
+    }
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "placeOrder", args).finally(abort);
+  }
+  /**
+   * update an order
+   */
+  updateOrder(ctx: Context, id: string, note?: string, priority?: number): Promise<void> {
+    const args = [id, note, priority];
+    while (args.length > 1 && args[args.length - 1] === undefined) {
+      args.pop();
+    }
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "updateOrder", args).finally(abort);
+  }
+  /**
+   * cancel an order
+   */
+  cancelOrder(ctx: Context, id: string): Promise<void> {
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "cancelOrder", [id]).finally(abort);
+  }
+  /**
+   * get an order
+   */
+  getOrder(ctx: Context, req: GetOrderRequest): Promise<GetOrderResponse> {
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getOrder", req).finally(abort);
+  }
+}
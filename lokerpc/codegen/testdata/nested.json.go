@@ -28,6 +28,8 @@ type NestedRPCClient struct {
 }
 
 func (c NestedRPCClient) GetUser(ctx context.Context, req GetUserRequest) (*GetUserResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
 	var res GetUserResponse
 	err := c.DoRequest(ctx, "getUser", req, &res)
 	if err != nil {
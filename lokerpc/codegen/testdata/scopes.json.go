@@ -0,0 +1,48 @@
+package orders
+
+import (
+	"context"
+	"time"
+
+	"github.com/LOKE/pkg/lokerpc"
+)
+
+type GetOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type GetOrderResponse struct {
+	Total float64 `json:"total"`
+}
+
+type RefundOrderRequest struct {
+	ID string `json:"id"`
+}
+
+type OrdersService interface {
+	GetOrder(context.Context, GetOrderRequest) (*GetOrderResponse, error)
+	RefundOrder(context.Context, RefundOrderRequest) error
+}
+
+type OrdersRPCClient struct {
+	lokerpc.Client
+}
+
+// GetOrder requires the scopes: orders:read
+func (c OrdersRPCClient) GetOrder(ctx context.Context, req GetOrderRequest) (*GetOrderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	var res GetOrderResponse
+	err := c.DoRequest(ctx, "getOrder", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RefundOrder requires the scopes: orders:write, payments:refund
+func (c OrdersRPCClient) RefundOrder(ctx context.Context, req RefundOrderRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
+	return c.DoRequest(ctx, "refundOrder", req, nil)
+}
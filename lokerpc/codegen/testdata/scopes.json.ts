@@ -0,0 +1,41 @@
+import { RPCContextClient } from "@loke/http-rpc-client";
+import { Context, withTimeout } from "@loke/context";
+
+export type GetOrderRequest = {
+  id: string;
+};
+
+export type GetOrderResponse = {
+  total: number;
+};
+
+export type RefundOrderRequest = {
+  id: string;
+};
+
+/**
+ * 
+ */
+export class OrdersService extends RPCContextClient {
+  constructor(baseUrl: string) {
+    super(baseUrl, "orders")
+  }
+  /**
+   * get an order
+   * 
+   * Requires the scopes: orders:read
+   */
+  getOrder(ctx: Context, req: GetOrderRequest): Promise<GetOrderResponse> {
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getOrder", req).finally(abort);
+  }
+  /**
+   * refund an order
+   * 
+   * Requires the scopes: orders:write, payments:refund
+   */
+  refundOrder(ctx: Context, req: RefundOrderRequest): Promise<void> {
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "refundOrder", req).finally(abort);
+  }
+}
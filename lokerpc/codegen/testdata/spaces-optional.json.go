@@ -2,6 +2,7 @@ package stripepayments
 
 import (
 	"context"
+	"time"
 
 	"github.com/LOKE/pkg/lokerpc"
 )
@@ -24,6 +25,8 @@ type StripePaymentsRPCClient struct {
 }
 
 func (c StripePaymentsRPCClient) GetAccountMetadata(ctx context.Context, req AccountMetadata) (*AccountMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
 	var res AccountMetadata
 	err := c.DoRequest(ctx, "getAccountMetadata", req, &res)
 	if err != nil {
@@ -1,5 +1,5 @@
 import { RPCContextClient } from "@loke/http-rpc-client";
-import { Context } from "@loke/context";
+import { Context, withTimeout } from "@loke/context";
 
 export type AccountMetadata = {
   Environment: string;
@@ -21,6 +21,7 @@ export class StripePaymentsService extends RPCContextClient {
    * Fetch account metadata
    */
   getAccountMetadata(ctx: Context, req: AccountMetadata): Promise<AccountMetadata> {
-    return this.request(ctx, "getAccountMetadata", req);
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getAccountMetadata", req).finally(abort);
   }
 }
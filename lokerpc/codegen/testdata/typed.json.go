@@ -2,6 +2,7 @@ package typed
 
 import (
 	"context"
+	"time"
 
 	"github.com/LOKE/pkg/lokerpc"
 )
@@ -25,6 +26,8 @@ type TypedRPCClient struct {
 }
 
 func (c TypedRPCClient) GetUser(ctx context.Context, req GetUserRequest) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
 	var res User
 	err := c.DoRequest(ctx, "getUser", req, &res)
 	if err != nil {
@@ -1,5 +1,5 @@
 import { RPCContextClient } from "@loke/http-rpc-client";
-import { Context } from "@loke/context";
+import { Context, withTimeout } from "@loke/context";
 
 export type KountaMeta = {
   acceptedMessage: string;
@@ -67,18 +67,21 @@ export class OrderingService extends RPCContextClient {
    * get config
    */
   getConfig(ctx: Context, req: GetConfigRequest): Promise<OrderingConfigMeta> {
-    return this.request(ctx, "getConfig", req);
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getConfig", req).finally(abort);
   }
   /**
    * get normal discriminator
    */
   getNormal(ctx: Context, req: GetNormalRequest): Promise<NormalDiscriminator> {
-    return this.request(ctx, "getNormal", req);
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getNormal", req).finally(abort);
   }
   /**
    * get metadata only union
    */
   getMetadataOnly(ctx: Context, req: GetMetadataOnlyRequest): Promise<MetadataOnlyUnion> {
-    return this.request(ctx, "getMetadataOnly", req);
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "getMetadataOnly", req).finally(abort);
   }
 }
@@ -2,6 +2,7 @@ package service1
 
 import (
 	"context"
+	"time"
 
 	"github.com/LOKE/pkg/lokerpc"
 )
@@ -15,5 +16,7 @@ type Service1RPCClient struct {
 }
 
 func (c Service1RPCClient) Hello1(ctx context.Context, req any) error {
+	ctx, cancel := context.WithTimeout(ctx, 60000*time.Millisecond)
+	defer cancel()
 	return c.DoRequest(ctx, "hello1", req, nil)
 }
@@ -1,5 +1,5 @@
 import { RPCContextClient } from "@loke/http-rpc-client";
-import { Context } from "@loke/context";
+import { Context, withTimeout } from "@loke/context";
 
 /**
  * hello
@@ -12,6 +12,7 @@ export class Service1Service extends RPCContextClient {
    * hello1 method
    */
   hello1(ctx: Context, req: any): Promise<void> {
-    return this.request(ctx, "hello1", req);
+    const [tctx, abort] = withTimeout(ctx, 60000);
+    return this.request(tctx, "hello1", req).finally(abort);
   }
 }
@@ -105,7 +105,11 @@ func GenTypescriptClient(w io.Writer, meta lokerpc.Meta) error {
 	b := bufio.NewWriter(w)
 
 	b.WriteString("import { RPCContextClient } from \"@loke/http-rpc-client\";\n")
-	b.WriteString("import { Context } from \"@loke/context\";\n")
+	if hasMethodTimeout(meta) {
+		b.WriteString("import { Context, withTimeout } from \"@loke/context\";\n")
+	} else {
+		b.WriteString("import { Context } from \"@loke/context\";\n")
+	}
 
 	for _, k := range defOrder {
 		b.WriteString("\n")
@@ -134,9 +138,24 @@ func GenTypescriptClient(w io.Writer, meta lokerpc.Meta) error {
 			}
 		}
 
-		tsDocComment(b, v.Help, "  ")
-		b.WriteString("  " + v.MethodName + "(ctx: Context, req: " + reqType + "): Promise<" + resType + "> {\n")
-		b.WriteString("    return this.request(ctx, \"" + v.MethodName + "\", req);\n  }\n")
+		doc := v.Help
+		if note := scopesNote(v); note != "" {
+			doc += "\n\n" + capitalize(note)
+		}
+		tsDocComment(b, doc, "  ")
+		params, args, argsStmt := "req: "+reqType, "req", ""
+		if pps, ok := positionalParams(meta, v); ok {
+			params, args, argsStmt = tsPositionalParams(pps)
+		}
+
+		b.WriteString("  " + v.MethodName + "(ctx: Context, " + params + "): Promise<" + resType + "> {\n")
+		b.WriteString(argsStmt)
+		if v.MethodTimeout > 0 {
+			fmt.Fprintf(b, "    const [tctx, abort] = withTimeout(ctx, %d);\n", v.MethodTimeout)
+			b.WriteString("    return this.request(tctx, \"" + v.MethodName + "\", " + args + ").finally(abort);\n  }\n")
+		} else {
+			b.WriteString("    return this.request(ctx, \"" + v.MethodName + "\", " + args + ");\n  }\n")
+		}
 	}
 
 	b.WriteString("}\n")
@@ -144,6 +163,72 @@ func GenTypescriptClient(w io.Writer, meta lokerpc.Meta) error {
 	return b.Flush()
 }
 
+// tsPositionalParams returns the params of a method signature, the args
+// passed to request, and any statements that build them. Optional params are
+// only marked optional if all the params after them are too, and are dropped
+// from the args when undefined, as JSON.stringify would send them as null.
+func tsPositionalParams(pps []positionalParam) (string, string, string) {
+	params := make([]string, len(pps))
+	args := make([]string, len(pps))
+
+	trailingOptional := true
+	required := 0
+	for i := len(pps) - 1; i >= 0; i-- {
+		p := pps[i]
+		name := tsParamName(p.name)
+		typ := GenTypescriptType(p.schema)
+
+		switch {
+		case p.optional && trailingOptional:
+			params[i] = name + "?: " + typ
+		case p.optional:
+			params[i] = name + ": " + typ + " | undefined"
+		default:
+			if trailingOptional {
+				required = i + 1
+			}
+			trailingOptional = false
+			params[i] = name + ": " + typ
+		}
+		args[i] = name
+	}
+
+	array := "[" + strings.Join(args, ", ") + "]"
+	if required == len(pps) {
+		return strings.Join(params, ", "), array, ""
+	}
+
+	stmt := "    const args = " + array + ";\n" +
+		fmt.Sprintf("    while (args.length > %d && args[args.length - 1] === undefined) {\n", required) +
+		"      args.pop();\n" +
+		"    }\n"
+	return strings.Join(params, ", "), "args", stmt
+}
+
+// tsParamName returns the identifier for a positional param, avoiding
+// reserved words and the names used in generated methods.
+func tsParamName(name string) string {
+	n := goParamName(name)
+	switch n = strings.TrimSuffix(n, "_"); n {
+	case "ctx", "tctx", "abort", "req", "args", "break", "case", "catch", "class", "const", "continue",
+		"debugger", "default", "delete", "do", "else", "enum", "export", "extends", "false",
+		"finally", "for", "function", "if", "import", "in", "instanceof", "new", "null",
+		"return", "super", "switch", "this", "throw", "true", "try", "typeof", "var",
+		"void", "while", "with", "yield", "let", "static", "await":
+		return n + "_"
+	}
+	return n
+}
+
+func hasMethodTimeout(meta lokerpc.Meta) bool {
+	for _, v := range meta.Interfaces {
+		if v.MethodTimeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func normalise(meta *lokerpc.Meta) []string {
 	var defOrder []string
 
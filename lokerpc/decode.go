@@ -0,0 +1,135 @@
+package lokerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// DecodeOptions controls how request bodies are decoded. The zero value
+// accepts bodies of any size and is lenient about their contents.
+type DecodeOptions struct {
+	// MaxRequestSize is the maximum size of a request body in bytes. Larger
+	// requests are rejected with a 413 status. Zero means no limit.
+	MaxRequestSize int64
+	// DisallowUnknownFields rejects requests with fields the request type
+	// doesn't have.
+	DisallowUnknownFields bool
+	// DisallowTrailingData rejects requests with anything other than
+	// whitespace after the JSON value.
+	DisallowTrailingData bool
+	// UseNumber decodes numbers into interface{} values as json.Number rather
+	// than float64.
+	UseNumber bool
+}
+
+// WithDecodeOptions sets how requests to the service are decoded.
+func WithDecodeOptions(do DecodeOptions) ServiceOption {
+	return func(o *serviceOptions) {
+		o.decode = do
+	}
+}
+
+// EndpointDecodeOptions sets how requests to the endpoint are decoded,
+// replacing the options set on the service. The service's MaxRequestSize
+// still applies unless do sets one.
+func EndpointDecodeOptions(do DecodeOptions) EndpointCodecOption {
+	return func(ec *EndpointCodec) {
+		ec.decodeOpts = &do
+	}
+}
+
+// merge returns the endpoint options do, taking MaxRequestSize from the
+// service options if do doesn't set one.
+func (do DecodeOptions) merge(so DecodeOptions) DecodeOptions {
+	if do.MaxRequestSize == 0 {
+		do.MaxRequestSize = so.MaxRequestSize
+	}
+	return do
+}
+
+type decodeOptionsKey struct{}
+
+// DecodeOptionsFromContext returns the DecodeOptions for the request being
+// decoded, for use by custom DecodeRequestFuncs.
+func DecodeOptionsFromContext(ctx context.Context) DecodeOptions {
+	do, _ := ctx.Value(decodeOptionsKey{}).(DecodeOptions)
+	return do
+}
+
+// errRequestTooLarge is returned when a request body exceeds MaxRequestSize.
+var errRequestTooLarge = &Error{
+	Message:   "request body too large",
+	Code:      "REQUEST_TOO_LARGE",
+	Namespace: "lokerpc",
+	Expose:    true,
+	Category:  CategoryTooLarge,
+}
+
+// readParams reads the JSON value from body, applying the size and trailing
+// data limits of do.
+func readParams(body io.Reader, contentLength int64, do DecodeOptions) (json.RawMessage, error) {
+	if do.MaxRequestSize > 0 {
+		if contentLength > do.MaxRequestSize {
+			return nil, errRequestTooLarge
+		}
+		body = io.LimitReader(body, do.MaxRequestSize+1)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if do.MaxRequestSize > 0 && int64(len(b)) > do.MaxRequestSize {
+		return nil, errRequestTooLarge
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+
+	var params json.RawMessage
+	if err := dec.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	if do.DisallowTrailingData {
+		if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+			return nil, errors.New("unexpected data after JSON value")
+		}
+	}
+
+	return params, nil
+}
+
+// namedParams converts positional params to an object keyed by names, the
+// order params are given in.
+func namedParams(params json.RawMessage, names []string) (json.RawMessage, error) {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil, nil
+	}
+
+	switch params[0] {
+	case '{':
+		return params, nil
+	case '[':
+	default:
+		return nil, errors.New("Invalid params: must be an object or array")
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(params, &values); err != nil {
+		return nil, err
+	}
+	if len(values) > len(names) {
+		return nil, errors.New("Invalid params: too many positional params")
+	}
+
+	obj := make(map[string]json.RawMessage, len(values))
+	for i, v := range values {
+		obj[names[i]] = v
+	}
+
+	return json.Marshal(obj)
+}
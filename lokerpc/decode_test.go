@@ -0,0 +1,126 @@
+package lokerpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+type decodeRequest struct {
+	ID    string `json:"id"`
+	Value any    `json:"value"`
+}
+
+func TestDecodeOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		serviceOpts DecodeOptions
+		endpointOpt *DecodeOptions
+		body        string
+		wantStatus  int
+		wantValue   any
+	}{
+		{
+			name:       "lenient by default",
+			body:       `{"id":"1","extra":true} trailing`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "rejects oversized body",
+			serviceOpts: DecodeOptions{MaxRequestSize: 16},
+			body:        `{"id":"12345678901234567890"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "accepts body within limit",
+			serviceOpts: DecodeOptions{MaxRequestSize: 16},
+			body:        `{"id":"1"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "rejects unknown fields",
+			serviceOpts: DecodeOptions{DisallowUnknownFields: true},
+			body:        `{"id":"1","extra":true}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "rejects trailing data",
+			serviceOpts: DecodeOptions{DisallowTrailingData: true},
+			body:        `{"id":"1"} {"id":"2"}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "allows trailing whitespace",
+			serviceOpts: DecodeOptions{DisallowTrailingData: true},
+			body:        "{\"id\":\"1\"}\n",
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "uses number",
+			serviceOpts: DecodeOptions{UseNumber: true},
+			body:        `{"value":12345678901234567890}`,
+			wantStatus:  http.StatusOK,
+			wantValue:   json.Number("12345678901234567890"),
+		},
+		{
+			name:        "endpoint options replace service options",
+			serviceOpts: DecodeOptions{DisallowUnknownFields: true},
+			endpointOpt: &DecodeOptions{},
+			body:        `{"id":"1","extra":true}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "endpoint options keep service size limit",
+			serviceOpts: DecodeOptions{MaxRequestSize: 16},
+			endpointOpt: &DecodeOptions{UseNumber: true},
+			body:        `{"id":"12345678901234567890"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "endpoint size limit overrides service",
+			serviceOpts: DecodeOptions{MaxRequestSize: 16},
+			endpointOpt: &DecodeOptions{MaxRequestSize: 64},
+			body:        `{"id":"12345678901234567890"}`,
+			wantStatus:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got any
+
+			var opts []EndpointCodecOption
+			if tc.endpointOpt != nil {
+				opts = append(opts, EndpointDecodeOptions(*tc.endpointOpt))
+			}
+
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, NewService("decode", "", EndpointCodecMap{
+				"set": MakeVoidEndpointCodec(func(_ context.Context, req decodeRequest) error {
+					got = req.Value
+					return nil
+				}, "", opts...),
+			}, WithDecodeOptions(tc.serviceOpts)))
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/decode/set", strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if got != tc.wantValue {
+				t.Errorf("expected value %#v, got %#v", tc.wantValue, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package lokerpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Category classifies an error, and determines the HTTP status it is served
+// with. It is also used as the "type" label of the failures metric.
+type Category string
+
+const (
+	CategoryBadRequest      Category = "bad_request"
+	CategoryUnauthorised    Category = "unauthorised"
+	CategoryForbidden       Category = "forbidden"
+	CategoryNotFound        Category = "not_found"
+	CategoryConflict        Category = "conflict"
+	CategoryTooLarge        Category = "too_large"
+	CategoryTooManyRequests Category = "too_many_requests"
+	CategoryUnavailable     Category = "unavailable"
+	CategoryTimeout         Category = "timeout"
+	CategoryInternal        Category = "internal"
+)
+
+// ErrDeadlineExceeded is returned when the request deadline elapses before or
+// during a call.
+var ErrDeadlineExceeded = &Error{
+	Message:   "request deadline exceeded",
+	Code:      "DEADLINE_EXCEEDED",
+	Namespace: "lokerpc",
+	Expose:    true,
+	Category:  CategoryTimeout,
+}
+
+// ErrInvalidParams is returned when the params of a call can't be decoded.
+// The message of each occurrence describes the problem.
+var ErrInvalidParams = &Error{
+	Message:   "invalid params",
+	Code:      "INVALID_PARAMS",
+	Namespace: "lokerpc",
+	Expose:    true,
+	Category:  CategoryBadRequest,
+}
+
+// StatusCode returns the HTTP status code for the category.
+func (c Category) StatusCode() int {
+	switch c {
+	case CategoryUnauthorised:
+		return http.StatusUnauthorized
+	case CategoryForbidden:
+		return http.StatusForbidden
+	case CategoryNotFound:
+		return http.StatusNotFound
+	case CategoryConflict:
+		return http.StatusConflict
+	case CategoryTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CategoryTooManyRequests:
+		return http.StatusTooManyRequests
+	case CategoryUnavailable:
+		return http.StatusServiceUnavailable
+	case CategoryTimeout:
+		return http.StatusGatewayTimeout
+	case CategoryInternal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// CategoryFromStatus returns the Category for a HTTP status code.
+func CategoryFromStatus(status int) Category {
+	switch {
+	case status == http.StatusUnauthorized:
+		return CategoryUnauthorised
+	case status == http.StatusForbidden:
+		return CategoryForbidden
+	case status == http.StatusNotFound:
+		return CategoryNotFound
+	case status == http.StatusConflict:
+		return CategoryConflict
+	case status == http.StatusRequestEntityTooLarge:
+		return CategoryTooLarge
+	case status == http.StatusTooManyRequests:
+		return CategoryTooManyRequests
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable:
+		return CategoryUnavailable
+	case status == http.StatusGatewayTimeout:
+		return CategoryTimeout
+	case status >= 500:
+		return CategoryInternal
+	default:
+		return CategoryBadRequest
+	}
+}
+
+// Categoriser is implemented by errors that know their Category.
+type Categoriser interface {
+	ErrorCategory() Category
+}
+
+// StatusCoder is implemented by errors that know which HTTP status they should
+// be served with.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// classify returns the category and HTTP status for err. Errors implementing
+// Categoriser take precedence over StatusCoder, and def is used if err
+// implements neither. Context deadline errors are always timeouts.
+func classify(err error, def Category) (Category, int) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CategoryTimeout, CategoryTimeout.StatusCode()
+	}
+
+	var c Categoriser
+	if errors.As(err, &c) {
+		if cat := c.ErrorCategory(); cat != "" {
+			return cat, cat.StatusCode()
+		}
+	}
+
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		status := sc.StatusCode()
+		return CategoryFromStatus(status), status
+	}
+
+	return def, def.StatusCode()
+}
+
+// Error is a structured rpc error. Endpoints can return an *Error (or wrap
+// one) to control exactly what is sent to the caller. The server serialises
+// it in full, and Client.DoRequest decodes error responses back into an
+// *Error, so errors.As works across Go services.
+type Error struct {
+	// Message is a human readable description of the error.
+	Message string `json:"message"`
+	// Code is a machine readable code, e.g. "ORDER_NOT_FOUND".
+	Code string `json:"code,omitempty"`
+	// Type is the error type, usually the name of the error within its
+	// namespace.
+	Type string `json:"type,omitempty"`
+	// Namespace groups error types, usually the originating service.
+	Namespace string `json:"namespace,omitempty"`
+	// Instance uniquely identifies this occurrence of the error, so it can be
+	// matched up with server side logs. It is filled in by the server if
+	// empty.
+	Instance string `json:"instance,omitempty"`
+	// Expose indicates the message is safe to show to end users.
+	Expose bool `json:"expose"`
+	// Details holds optional extra information about the error.
+	Details map[string]any `json:"details,omitempty"`
+	// Retryable signals the call can safely be retried, even if the method
+	// isn't idempotent.
+	Retryable bool `json:"retryable,omitempty"`
+
+	// Category classifies the error. It isn't sent over the wire, as it is
+	// implied by the HTTP status of the response, which the client uses to
+	// set it again.
+	Category Category `json:"-"`
+
+	// retryAfter is how long the server asked the client to wait before
+	// retrying, from the Retry-After header of a 429 or 503 response.
+	retryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorID returns the instance id of the error.
+func (e *Error) ErrorID() string {
+	return e.Instance
+}
+
+// ErrorType returns the type of the error.
+func (e *Error) ErrorType() string {
+	return e.Type
+}
+
+// ErrorCategory returns the category of the error.
+func (e *Error) ErrorCategory() Category {
+	return e.Category
+}
+
+// Public reports whether the error message can be shown to end users.
+func (e *Error) Public() bool {
+	return e.Expose
+}
+
+// Is reports whether target is an *Error with the same Namespace and Code.
+// This allows sentinel errors to be compared with errors.Is, even once they
+// have been decoded by a client.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || t.Code == "" {
+		return false
+	}
+	return e.Code == t.Code && e.Namespace == t.Namespace
+}
+
+// asError converts err to an *Error suitable for sending in a response. If err
+// does not wrap an *Error, only its message is kept.
+func asError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		e := *rpcErr
+		return &e
+	}
+	return &Error{Message: err.Error()}
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,222 @@
+package lokerpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var errOrderNotFound = &Error{
+	Message:   "order not found",
+	Code:      "ORDER_NOT_FOUND",
+	Type:      "OrderNotFound",
+	Namespace: "orders",
+	Expose:    true,
+}
+
+type getOrderRequest struct {
+	ID string `json:"id"`
+}
+
+func TestErrorRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		err     error
+		want    *Error
+		wantNil bool
+	}{
+		{
+			name: "structured error",
+			err: &Error{
+				Message:   "order not found",
+				Code:      "ORDER_NOT_FOUND",
+				Type:      "OrderNotFound",
+				Namespace: "orders",
+				Expose:    true,
+				Details:   map[string]any{"id": "123"},
+			},
+			want: &Error{
+				Message:   "order not found",
+				Code:      "ORDER_NOT_FOUND",
+				Type:      "OrderNotFound",
+				Namespace: "orders",
+				Expose:    true,
+				Details:   map[string]any{"id": "123"},
+				Category:  CategoryBadRequest,
+			},
+		},
+		{
+			name: "wrapped structured error",
+			err:  wrapErr{errOrderNotFound},
+			want: &Error{
+				Message:   "order not found",
+				Code:      "ORDER_NOT_FOUND",
+				Type:      "OrderNotFound",
+				Namespace: "orders",
+				Expose:    true,
+				Category:  CategoryBadRequest,
+			},
+		},
+		{
+			name: "plain error",
+			err:  errors.New("boom"),
+			want: &Error{Message: "boom", Category: CategoryBadRequest},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, NewService("orders", "", EndpointCodecMap{
+				"getOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error {
+					return tc.err
+				}, ""),
+			}))
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			c := NewClient(srv.URL + "/rpc/orders")
+			err := c.DoRequest(context.Background(), "getOrder", getOrderRequest{ID: "123"}, nil)
+
+			var got *Error
+			if !errors.As(err, &got) {
+				t.Fatalf("expected *Error, got %T: %v", err, err)
+			}
+
+			if got.Instance == "" {
+				t.Error("expected instance id to be set")
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(Error{}), cmpopts.IgnoreFields(Error{}, "Instance")); diff != "" {
+				t.Errorf("error mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		endpoint   Endpoint
+		wantStatus int
+		wantCat    Category
+	}{
+		{
+			name: "unclassified failure",
+			endpoint: MakeVoidEndpoint(func(context.Context, getOrderRequest) error {
+				return errors.New("boom")
+			}),
+			wantStatus: http.StatusBadRequest,
+			wantCat:    CategoryBadRequest,
+		},
+		{
+			name: "categorised failure",
+			endpoint: MakeVoidEndpoint(func(context.Context, getOrderRequest) error {
+				return &Error{Message: "order not found", Category: CategoryNotFound}
+			}),
+			wantStatus: http.StatusNotFound,
+			wantCat:    CategoryNotFound,
+		},
+		{
+			name: "status coder failure",
+			endpoint: MakeVoidEndpoint(func(context.Context, getOrderRequest) error {
+				return statusErr(http.StatusConflict)
+			}),
+			wantStatus: http.StatusConflict,
+			wantCat:    CategoryConflict,
+		},
+		{
+			name: "unclassified endpoint error",
+			endpoint: func(context.Context, any) (any, error) {
+				return nil, errors.New("transport failure")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCat:    CategoryInternal,
+		},
+		{
+			name: "categorised endpoint error",
+			endpoint: func(context.Context, any) (any, error) {
+				return nil, &Error{Message: "down", Category: CategoryUnavailable}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCat:    CategoryUnavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, NewService("classify", "", EndpointCodecMap{
+				"getOrder": EndpointCodec{
+					Endpoint: tc.endpoint,
+					Decode:   DecodeRequest[getOrderRequest],
+				},
+			}))
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			res, err := http.Post(srv.URL+"/rpc/classify/getOrder", "application/json", strings.NewReader(`{"id":"1"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, res.StatusCode)
+			}
+
+			err = NewClient(srv.URL+"/rpc/classify").DoRequest(context.Background(), "getOrder", getOrderRequest{ID: "1"}, nil)
+
+			var rpcErr *Error
+			if !errors.As(err, &rpcErr) {
+				t.Fatalf("expected *Error, got %T: %v", err, err)
+			}
+			if rpcErr.Category != tc.wantCat {
+				t.Errorf("expected category %q, got %q", tc.wantCat, rpcErr.Category)
+			}
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	t.Parallel()
+
+	decoded := &Error{Message: "order not found", Code: "ORDER_NOT_FOUND", Namespace: "orders", Instance: "abc"}
+
+	if !errors.Is(decoded, errOrderNotFound) {
+		t.Error("expected decoded error to match sentinel")
+	}
+	if errors.Is(&Error{Message: "other", Code: "OTHER", Namespace: "orders"}, errOrderNotFound) {
+		t.Error("expected errors with different codes not to match")
+	}
+	if errors.Is(&Error{Message: "no code"}, &Error{Message: "no code"}) {
+		t.Error("expected errors without codes not to match")
+	}
+}
+
+type statusErr int
+
+func (e statusErr) Error() string   { return http.StatusText(int(e)) }
+func (e statusErr) StatusCode() int { return int(e) }
+
+type wrapErr struct{ err error }
+
+func (e wrapErr) Error() string { return "wrapped: " + e.err.Error() }
+func (e wrapErr) Unwrap() error { return e.err }
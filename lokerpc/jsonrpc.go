@@ -0,0 +1,250 @@
+package lokerpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/LOKE/pkg/tracing"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	// JSONRPCServerError is the code of errors returned by endpoints. The
+	// *Error is sent as the error data.
+	JSONRPCServerError = -32000
+)
+
+// DefaultMaxJSONRPCRequestSize is the maximum size of a JSON-RPC request body
+// in bytes when a mounted service has no MaxRequestSize.
+const DefaultMaxJSONRPCRequestSize = 10 << 20
+
+// MountJSONRPC mounts services on a single JSON-RPC 2.0 endpoint at pattern,
+// with methods named "<service>.<method>". Params can be given by name, or by
+// position in the order of the endpoint's ParamNames. Batches and
+// notifications are supported.
+//
+// Calls are handled exactly as if they were made with MountHandlers,
+// including authentication, middleware and metrics. Options are applied as
+// they are by Mount.
+//
+// A request body, which may be a batch, can be up to DefaultMaxBatchItems
+// times the largest MaxRequestSize of the services, or
+// DefaultMaxJSONRPCRequestSize if any of them has no limit. Request ids are
+// accepted by the policy set by opts, as the endpoint isn't any one service's.
+func MountJSONRPC(logger log.Logger, mux Mux, pattern string, services []*Service, opts ...ServiceOption) {
+	h := &jsonrpcHandler{
+		logger:  logger,
+		methods: map[string]jsonrpcMethod{},
+	}
+
+	var maxSize int64
+	for _, service := range services {
+		o := service.options(opts)
+		if o.decode.MaxRequestSize <= 0 || maxSize < 0 {
+			maxSize = -1
+		} else if o.decode.MaxRequestSize > maxSize {
+			maxSize = o.decode.MaxRequestSize
+		}
+
+		handlers := service.handlers(logger, o)
+		for methodName, ec := range service.endpointCodecs {
+			h.methods[service.Name+"."+methodName] = jsonrpcMethod{
+				service:    service.Name,
+				method:     methodName,
+				handler:    handlers[methodName],
+				paramNames: ec.ParamNames,
+			}
+		}
+	}
+
+	h.decode.MaxRequestSize = DefaultMaxJSONRPCRequestSize
+	if maxSize > 0 {
+		h.decode.MaxRequestSize = maxSize * DefaultMaxBatchItems
+	}
+
+	var mo serviceOptions
+	for _, opt := range opts {
+		opt(&mo)
+	}
+
+	mux.Handle(pattern, mo.requestIDMiddleware(tracing.Middleware("jsonrpc", h)))
+}
+
+type jsonrpcMethod struct {
+	service    string
+	method     string
+	handler    http.Handler
+	paramNames []string
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    *Error `json:"data,omitempty"`
+}
+
+var jsonrpcNullID = json.RawMessage("null")
+
+func jsonrpcErrorResponse(id json.RawMessage, code int, message string) *jsonrpcResponse {
+	return &jsonrpcResponse{
+		JSONRPC: "2.0",
+		Error:   &jsonrpcError{Code: code, Message: message},
+		ID:      id,
+	}
+}
+
+type jsonrpcHandler struct {
+	logger  log.Logger
+	methods map[string]jsonrpcMethod
+	decode  DecodeOptions
+}
+
+func (h *jsonrpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "405 must POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := readParams(r.Body, r.ContentLength, h.decode)
+	if errors.Is(err, errRequestTooLarge) {
+		writeError(w, CategoryTooLarge.StatusCode(), asError(errRequestTooLarge))
+		return
+	}
+	if err != nil {
+		h.write(w, jsonrpcErrorResponse(jsonrpcNullID, JSONRPCParseError, "Parse error"))
+		return
+	}
+
+	shareDeadline(r)
+
+	if !bytes.HasPrefix(body, []byte("[")) {
+		if res := h.call(r, body); res != nil {
+			h.write(w, res)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		h.write(w, jsonrpcErrorResponse(jsonrpcNullID, JSONRPCParseError, "Parse error"))
+		return
+	}
+	if len(batch) == 0 || len(batch) > DefaultMaxBatchItems {
+		h.write(w, jsonrpcErrorResponse(jsonrpcNullID, JSONRPCInvalidRequest, "Invalid Request"))
+		return
+	}
+
+	var results []*jsonrpcResponse
+	for _, raw := range batch {
+		if res := h.call(r, raw); res != nil {
+			results = append(results, res)
+		}
+	}
+	if len(results) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.write(w, results)
+}
+
+// call handles a single JSON-RPC request, returning nil for notifications.
+func (h *jsonrpcHandler) call(r *http.Request, raw json.RawMessage) *jsonrpcResponse {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || !validJSONRPCID(req.ID) {
+		return jsonrpcErrorResponse(jsonrpcNullID, JSONRPCInvalidRequest, "Invalid Request")
+	}
+
+	notification := req.ID == nil
+	id := req.ID
+	if notification {
+		id = jsonrpcNullID
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return jsonrpcErrorResponse(id, JSONRPCInvalidRequest, "Invalid Request")
+	}
+
+	m, ok := h.methods[req.Method]
+	if !ok {
+		if notification {
+			return nil
+		}
+		return jsonrpcErrorResponse(id, JSONRPCMethodNotFound, "Method not found")
+	}
+
+	params, err := namedParams(req.Params, m.paramNames)
+	if err != nil {
+		if notification {
+			return nil
+		}
+		return jsonrpcErrorResponse(id, JSONRPCInvalidParams, err.Error())
+	}
+
+	res := callHandler(r, m.service, m.method, m.handler, params)
+	if notification {
+		return nil
+	}
+
+	if res.Error == nil {
+		return &jsonrpcResponse{JSONRPC: "2.0", Result: res.Result, ID: id}
+	}
+
+	code := JSONRPCServerError
+	switch {
+	case errors.Is(res.Error, ErrInvalidParams):
+		code = JSONRPCInvalidParams
+	case res.Status == http.StatusInternalServerError:
+		code = JSONRPCInternalError
+	}
+
+	return &jsonrpcResponse{
+		JSONRPC: "2.0",
+		Error:   &jsonrpcError{Code: code, Message: res.Error.Message, Data: res.Error},
+		ID:      id,
+	}
+}
+
+func (h *jsonrpcHandler) write(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		level.Error(h.logger).Log("msg", "failed to write jsonrpc response", "err", err)
+	}
+}
+
+// validJSONRPCID reports whether id is absent, or a string, number or null.
+func validJSONRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	switch c := id[0]; {
+	case c == '"', c == '-', c >= '0' && c <= '9', c == 'n':
+		return true
+	}
+	return false
+}
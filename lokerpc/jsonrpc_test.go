@@ -0,0 +1,204 @@
+package lokerpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func newJSONRPCService(calls *int32) *Service {
+	return NewService("orders", "", EndpointCodecMap{
+		"getOrder": MakeStandardEndpointCodec(func(_ context.Context, req getOrderRequest) (orderTotal, error) {
+			atomic.AddInt32(calls, 1)
+			if req.ID == "missing" {
+				return orderTotal{}, errOrderNotFound
+			}
+			return orderTotal{Total: float64(len(req.ID))}, nil
+		}, ""),
+		"cancelOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error {
+			atomic.AddInt32(calls, 1)
+			return nil
+		}, ""),
+	})
+}
+
+func TestJSONRPC(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       string
+		wantCode   int
+		wantCalls  int32
+	}{
+		{
+			name:       "named params",
+			body:       `{"jsonrpc":"2.0","method":"orders.getOrder","params":{"id":"abc"},"id":1}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","result":{"total":3},"id":1}`,
+			wantCalls:  1,
+		},
+		{
+			name:       "positional params",
+			body:       `{"jsonrpc":"2.0","method":"orders.getOrder","params":["ab"],"id":"x"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","result":{"total":2},"id":"x"}`,
+			wantCalls:  1,
+		},
+		{
+			name:       "void result",
+			body:       `{"jsonrpc":"2.0","method":"orders.cancelOrder","id":2}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","result":null,"id":2}`,
+			wantCalls:  1,
+		},
+		{
+			name:       "notification",
+			body:       `{"jsonrpc":"2.0","method":"orders.cancelOrder","params":{"id":"a"}}`,
+			wantStatus: http.StatusNoContent,
+			wantCalls:  1,
+		},
+		{
+			name:       "endpoint error",
+			body:       `{"jsonrpc":"2.0","method":"orders.getOrder","params":{"id":"missing"},"id":1}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","error":{"code":-32000,"message":"order not found","data":{"message":"order not found","code":"ORDER_NOT_FOUND","type":"OrderNotFound","namespace":"orders","expose":true}},"id":1}`,
+			wantCalls:  1,
+		},
+		{
+			name:       "method not found",
+			body:       `{"jsonrpc":"2.0","method":"orders.nope","id":1}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":1}`,
+		},
+		{
+			name:       "too many positional params",
+			body:       `{"jsonrpc":"2.0","method":"orders.getOrder","params":["a","b"],"id":1}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: too many positional params"},"id":1}`,
+		},
+		{
+			name:       "undecodable params",
+			body:       `{"jsonrpc":"2.0","method":"orders.getOrder","params":{"id":1},"id":1}`,
+			wantStatus: http.StatusOK,
+			wantCode:   JSONRPCInvalidParams,
+		},
+		{
+			name:       "parse error",
+			body:       `{"jsonrpc":`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name:       "invalid request",
+			body:       `{"method":"orders.getOrder","id":1}`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":1}`,
+		},
+		{
+			name:       "empty batch",
+			body:       `[]`,
+			wantStatus: http.StatusOK,
+			want:       `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name: "batch",
+			body: `[
+				{"jsonrpc":"2.0","method":"orders.getOrder","params":["a"],"id":1},
+				{"jsonrpc":"2.0","method":"orders.cancelOrder","params":{"id":"a"}},
+				1,
+				{"jsonrpc":"2.0","method":"orders.getOrder","params":{"id":"abcd"},"id":2}
+			]`,
+			wantStatus: http.StatusOK,
+			want: `[
+				{"jsonrpc":"2.0","result":{"total":1},"id":1},
+				{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},
+				{"jsonrpc":"2.0","result":{"total":4},"id":2}
+			]`,
+			wantCalls: 3,
+		},
+		{
+			name:       "batch of notifications",
+			body:       `[{"jsonrpc":"2.0","method":"orders.cancelOrder"}]`,
+			wantStatus: http.StatusNoContent,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+			mux := http.NewServeMux()
+			MountJSONRPC(log.NewNopLogger(), mux, "/jsonrpc", []*Service{newJSONRPCService(&calls)})
+
+			req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("expected %d calls, got %d", tc.wantCalls, calls)
+			}
+			if tc.wantCode != 0 {
+				var res jsonrpcResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatal(err)
+				}
+				if res.Error == nil || res.Error.Code != tc.wantCode {
+					t.Errorf("expected error code %d, got %s", tc.wantCode, rec.Body)
+				}
+			}
+			if tc.want == "" {
+				return
+			}
+
+			var want, got any
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreMapEntries(func(k string, _ any) bool { return k == "instance" })); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONRPCMaxRequestSize(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	service := newJSONRPCService(&calls)
+	service.opts = append(service.opts, WithDecodeOptions(DecodeOptions{MaxRequestSize: 16}))
+
+	mux := http.NewServeMux()
+	MountJSONRPC(log.NewNopLogger(), mux, "/jsonrpc", []*Service{service})
+
+	body := `{"jsonrpc":"2.0","method":"orders.getOrder","params":["` + strings.Repeat("a", 16*DefaultMaxBatchItems) + `"],"id":1}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(body)))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, rec.Code, rec.Body)
+	}
+	if calls != 0 {
+		t.Errorf("expected no calls, got %d", calls)
+	}
+}
@@ -0,0 +1,186 @@
+package lokerpc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a call is rejected by a limiter. It is
+// served with a 429 status and a Retry-After header, and is marked Retryable
+// so clients back off and try again.
+var ErrRateLimited = &Error{
+	Message:   "rate limit exceeded",
+	Code:      "RATE_LIMITED",
+	Namespace: "lokerpc",
+	Expose:    true,
+	Retryable: true,
+	Category:  CategoryTooManyRequests,
+}
+
+// limitError wraps ErrRateLimited with the time the caller should wait.
+type limitError struct {
+	err        *Error
+	retryAfter time.Duration
+}
+
+func (e limitError) Error() string             { return e.err.Error() }
+func (e limitError) Unwrap() error             { return e.err }
+func (e limitError) RetryAfter() time.Duration { return e.retryAfter }
+
+func rateLimited(message string, retryAfter time.Duration) error {
+	e := *ErrRateLimited
+	e.Message = message
+	return limitError{&e, retryAfter}
+}
+
+// LimitKeyFunc returns the key a call is limited by. Calls with the same key
+// share a limit. A nil LimitKeyFunc limits all calls together.
+type LimitKeyFunc func(ctx context.Context) string
+
+// KeyByPrincipal limits calls per authenticated caller. Unauthenticated calls
+// share a limit.
+func KeyByPrincipal(ctx context.Context) string {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// KeyByHeader limits calls per value of the request header.
+func KeyByHeader(header string) LimitKeyFunc {
+	return func(ctx context.Context) string {
+		ci, _ := CallInfoFromContext(ctx)
+		return ci.Header.Get(header)
+	}
+}
+
+// RateLimit returns Middleware that allows rate calls per second per key,
+// with bursts of up to burst calls, using a token bucket. Attach it with
+// WithMiddleware to limit a whole service, or EndpointMiddleware to limit a
+// single endpoint.
+func RateLimit(rate float64, burst int, key LimitKeyFunc) Middleware {
+	l := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req any) (any, error) {
+			if wait := l.take(limitKey(ctx, key), time.Now()); wait > 0 {
+				return nil, rateLimited(ErrRateLimited.Message, wait)
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// ConcurrencyLimit returns Middleware that allows at most n calls per key to
+// run at once.
+func ConcurrencyLimit(n int, key LimitKeyFunc) Middleware {
+	l := &concurrencyLimiter{max: n, running: map[string]int{}}
+
+	return func(next Endpoint) Endpoint {
+		return func(ctx context.Context, req any) (any, error) {
+			k := limitKey(ctx, key)
+			if !l.acquire(k) {
+				return nil, rateLimited("too many concurrent requests", time.Second)
+			}
+			defer l.release(k)
+
+			return next(ctx, req)
+		}
+	}
+}
+
+func limitKey(ctx context.Context, key LimitKeyFunc) string {
+	if key == nil {
+		return ""
+	}
+	return key(ctx)
+}
+
+// maxBuckets is the number of keys a rateLimiter holds before discarding
+// buckets that have refilled.
+const maxBuckets = 10000
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// take removes a token from the bucket for key, returning how long to wait
+// for one if it is empty.
+func (l *rateLimiter) take(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.sweep(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		if l.rate <= 0 {
+			return time.Minute
+		}
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return 0
+}
+
+// sweep discards buckets that have refilled, as they are no different to new
+// ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+type concurrencyLimiter struct {
+	max int
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func (l *concurrencyLimiter) acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running[key] >= l.max {
+		return false
+	}
+	l.running[key]++
+	return true
+}
+
+func (l *concurrencyLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running[key]--; l.running[key] <= 0 {
+		delete(l.running, key)
+	}
+}
@@ -0,0 +1,126 @@
+package lokerpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	mux := http.NewServeMux()
+	MountHandlers(log.NewLogfmtLogger(&buf), mux, NewService("orders", "", EndpointCodecMap{
+		"getOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error { return nil }, ""),
+	}, WithMiddleware(RateLimit(0.001, 2, KeyByHeader("X-Tenant")))))
+
+	call := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/rpc/orders/getOrder", strings.NewReader(`{"id":"1"}`))
+		req.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := call("a"); rec.Code != http.StatusOK {
+			t.Fatalf("expected burst call %d to succeed, got %d", i, rec.Code)
+		}
+	}
+
+	rec := call("a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got == "" || got == "0" {
+		t.Errorf("expected Retry-After header, got %q", got)
+	}
+	if logs := buf.String(); !strings.Contains(logs, "level=warn") || strings.Contains(logs, "level=error") {
+		t.Errorf("expected rejection to be logged as a warning, got %q", logs)
+	}
+
+	if rec := call("b"); rec.Code != http.StatusOK {
+		t.Errorf("expected other tenant to have its own limit, got %d", rec.Code)
+	}
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	err := NewClient(srv.URL+"/rpc/orders", WithHeader("X-Tenant", "a")).DoRequest(context.Background(), "getOrder", getOrderRequest{ID: "1"}, nil)
+
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected rate limited error, got %v", err)
+	}
+	if !rpcErr.Retryable || rpcErr.Category != CategoryTooManyRequests {
+		t.Errorf("expected retryable too many requests error, got %+v", rpcErr)
+	}
+	if !shouldRetry(context.Background(), err, false) {
+		t.Error("expected client to retry rate limited calls")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	t.Parallel()
+
+	l := &rateLimiter{rate: 2, burst: 1, buckets: map[string]*tokenBucket{}}
+	now := time.Now()
+
+	if wait := l.take("k", now); wait != 0 {
+		t.Fatalf("expected first call to be allowed, waited %v", wait)
+	}
+	if wait := l.take("k", now); wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms, got %v", wait)
+	}
+	if wait := l.take("k", now.Add(500*time.Millisecond)); wait != 0 {
+		t.Errorf("expected refilled bucket to allow call, waited %v", wait)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("orders", "", EndpointCodecMap{
+		"getOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error {
+			entered <- struct{}{}
+			<-release
+			return nil
+		}, "", EndpointMiddleware(ConcurrencyLimit(1, nil))),
+	}))
+
+	call := func() int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/orders/getOrder", strings.NewReader(`{"id":"1"}`)))
+		return rec.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- call() }()
+	<-entered
+
+	if code := call(); code != http.StatusTooManyRequests {
+		t.Errorf("expected concurrent call to be rejected, got %d", code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected first call to succeed, got %d", code)
+	}
+
+	go func() { <-entered }()
+	if code := call(); code != http.StatusOK {
+		t.Errorf("expected call after release to succeed, got %d", code)
+	}
+}
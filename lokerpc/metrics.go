@@ -0,0 +1,279 @@
+package lokerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var sizeBuckets = prometheus.ExponentialBuckets(64, 4, 8)
+
+type serverMetrics struct {
+	duration     *prometheus.HistogramVec
+	requests     *prometheus.CounterVec
+	failures     *prometheus.CounterVec
+	inFlight     *prometheus.GaugeVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+
+	// buckets are the buckets of duration.
+	buckets []float64
+}
+
+var (
+	serverMetricsMu    sync.Mutex
+	serverMetricsByReg = map[prometheus.Registerer]*serverMetrics{}
+)
+
+// metricsFor returns the server metrics registered with reg, creating and
+// registering them on first use. Collectors already registered by another
+// copy of this package are reused.
+//
+// Nil buckets accept whatever the metrics were created with, or
+// prometheus.DefBuckets. Other buckets must match those already in use, as
+// they can't be changed once registered, so a conflict panics.
+func metricsFor(reg prometheus.Registerer, buckets []float64) *serverMetrics {
+	serverMetricsMu.Lock()
+	defer serverMetricsMu.Unlock()
+
+	if m, ok := serverMetricsByReg[reg]; ok {
+		if buckets != nil && !equalBuckets(m.buckets, buckets) {
+			panic(fmt.Sprintf("lokerpc: duration buckets %v conflict with %v already registered", buckets, m.buckets))
+		}
+		return m
+	}
+
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+
+	labels := []string{"service", "method"}
+
+	m := &serverMetrics{
+		duration: registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_rpc_request_duration_seconds",
+			Help:    "Duration of rpc requests",
+			Buckets: buckets,
+		}, []string{"service", "method", "status"})),
+		requests: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rpc_requests_total",
+			Help: "The total number of rpc requests received",
+		}, labels)),
+		failures: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rpc_failures_total",
+			Help: "The total number of rpc failures received",
+		}, []string{"service", "method", "type"})),
+		inFlight: registerCollector(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_rpc_requests_in_flight",
+			Help: "The number of rpc requests currently being handled",
+		}, labels)),
+		requestSize: registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_rpc_request_size_bytes",
+			Help:    "Size of rpc request bodies",
+			Buckets: sizeBuckets,
+		}, labels)),
+		responseSize: registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_rpc_response_size_bytes",
+			Help:    "Size of rpc response bodies",
+			Buckets: sizeBuckets,
+		}, labels)),
+		buckets: buckets,
+	}
+	serverMetricsByReg[reg] = m
+
+	return m
+}
+
+func equalBuckets(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// registerCollector registers c with reg, returning the existing collector if
+// an identical one is already registered. Any other error panics, like
+// prometheus.MustRegister.
+func registerCollector[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// instrument wraps the handler for a single method, recording its metrics.
+func (m *serverMetrics) instrument(service, method string, next http.Handler) http.Handler {
+	requests := m.requests.WithLabelValues(service, method)
+	inFlight := m.inFlight.WithLabelValues(service, method)
+	requestSize := m.requestSize.WithLabelValues(service, method)
+	responseSize := m.responseSize.WithLabelValues(service, method)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requests.Inc()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		mw := &metricsWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(mw, r)
+
+		m.duration.WithLabelValues(service, method, strconv.Itoa(mw.status)).Observe(time.Since(start).Seconds())
+		requestSize.Observe(float64(body.n))
+		responseSize.Observe(float64(mw.n))
+
+		if mw.status >= 400 {
+			failureType := mw.failureType
+			if failureType == "" {
+				failureType = string(CategoryFromStatus(mw.status))
+			}
+			m.failures.WithLabelValues(service, method, failureType).Inc()
+		}
+	})
+}
+
+// metricsWriter records the status and size of a response, along with the
+// failure type of error responses.
+type metricsWriter struct {
+	http.ResponseWriter
+	status      int
+	n           int
+	failureType string
+}
+
+func (w *metricsWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += n
+	return n, err
+}
+
+// setFailureType sets the "type" label of the failures metric for the
+// response, if w is instrumented.
+func setFailureType(w http.ResponseWriter, failureType string) {
+	if mw, ok := w.(*metricsWriter); ok {
+		mw.failureType = failureType
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n += n
+	return n, err
+}
+
+type clientMetrics struct {
+	duration *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+	failures *prometheus.CounterVec
+}
+
+var (
+	clientMetricsMu    sync.Mutex
+	clientMetricsByReg = map[prometheus.Registerer]*clientMetrics{}
+)
+
+// clientMetricsFor returns the client metrics registered with reg, creating
+// and registering them on first use.
+func clientMetricsFor(reg prometheus.Registerer) *clientMetrics {
+	clientMetricsMu.Lock()
+	defer clientMetricsMu.Unlock()
+
+	if m, ok := clientMetricsByReg[reg]; ok {
+		return m
+	}
+
+	labels := []string{"service", "method"}
+
+	m := &clientMetrics{
+		duration: registerCollector(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "http_rpc_client_request_duration_seconds",
+			Help: "Duration of outbound rpc calls",
+		}, labels)),
+		requests: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rpc_client_requests_total",
+			Help: "The total number of outbound rpc calls",
+		}, labels)),
+		failures: registerCollector(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rpc_client_failures_total",
+			Help: "The total number of failed outbound rpc calls",
+		}, []string{"service", "method", "type"})),
+	}
+	clientMetricsByReg[reg] = m
+
+	return m
+}
+
+// middleware records metrics for each call to service.
+func (m *clientMetrics) middleware(service string) ClientMiddleware {
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, method string, args, result any) error {
+			start := time.Now()
+			err := next(ctx, method, args, result)
+
+			m.requests.WithLabelValues(service, method).Inc()
+			m.duration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+			if err != nil {
+				m.failures.WithLabelValues(service, method, clientFailureType(err)).Inc()
+			}
+
+			return err
+		}
+	}
+}
+
+// clientFailureType classifies a client error as "timeout", "circuit_open",
+// "4xx", "5xx", or "transport" if no response was received.
+func clientFailureType(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	// Rejected by the client without calling the server, so not the
+	// server's failure
+	if errors.Is(err, ErrCircuitOpen) {
+		return "circuit_open"
+	}
+
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) {
+		return "transport"
+	}
+
+	switch rpcErr.Category {
+	case CategoryTimeout:
+		return "timeout"
+	case CategoryInternal, CategoryUnavailable:
+		return "5xx"
+	default:
+		return "4xx"
+	}
+}
@@ -0,0 +1,163 @@
+package lokerpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type metricsRequest struct{}
+
+func newMetricsService(name string, opts ...ServiceOption) *Service {
+	return NewService(name, "", EndpointCodecMap{
+		"hello": MakeVoidEndpointCodec(func(context.Context, metricsRequest) error { return nil }, ""),
+		"fail": MakeVoidEndpointCodec(func(context.Context, metricsRequest) error {
+			return &Error{Message: "missing", Category: CategoryNotFound}
+		}, ""),
+	}, opts...)
+}
+
+func callHello(t *testing.T, mux http.Handler, service string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/"+service+"/hello", strings.NewReader("{}")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMountRegisterer(t *testing.T) {
+	t.Parallel()
+
+	mountReg := prometheus.NewRegistry()
+	serviceReg := prometheus.NewRegistry()
+
+	mux := http.NewServeMux()
+	Mount(log.NewNopLogger(), mux, []*Service{
+		newMetricsService("mount"),
+		newMetricsService("scoped", WithRegisterer(serviceReg)),
+	}, WithRegisterer(mountReg))
+
+	callHello(t, mux, "mount")
+	callHello(t, mux, "scoped")
+	callHello(t, mux, "scoped")
+
+	if got := testutil.ToFloat64(metricsFor(mountReg, nil).requests.WithLabelValues("mount", "hello")); got != 1 {
+		t.Errorf("expected 1 request on mount registry, got %v", got)
+	}
+	if got := testutil.ToFloat64(metricsFor(serviceReg, nil).requests.WithLabelValues("scoped", "hello")); got != 2 {
+		t.Errorf("expected 2 requests on service registry, got %v", got)
+	}
+	if got := testutil.ToFloat64(metricsFor(mountReg, nil).requests.WithLabelValues("scoped", "hello")); got != 0 {
+		t.Errorf("expected service registry to take precedence, got %v requests on mount registry", got)
+	}
+}
+
+func TestMountRegistererReused(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+
+	// Mounting services on the same registry twice must not panic
+	for i := 0; i < 2; i++ {
+		mux := http.NewServeMux()
+		MountHandlers(log.NewNopLogger(), mux, newMetricsService("reused", WithRegisterer(reg)))
+		callHello(t, mux, "reused")
+	}
+
+	if got := testutil.ToFloat64(metricsFor(reg, nil).requests.WithLabelValues("reused", "hello")); got != 2 {
+		t.Errorf("expected 2 requests, got %v", got)
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	t.Parallel()
+
+	reg := prometheus.NewRegistry()
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, newMetricsService("labels", WithRegisterer(reg), WithBuckets([]float64{0.5, 1})))
+
+	callHello(t, mux, "labels")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/labels/fail", strings.NewReader("{}")))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	durations := map[string]uint64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "http_rpc_request_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var key []string
+			for _, lp := range m.GetLabel() {
+				key = append(key, lp.GetName()+"="+lp.GetValue())
+			}
+			durations[strings.Join(key, ",")] = m.GetHistogram().GetSampleCount()
+
+			if n := len(m.GetHistogram().GetBucket()); n != 2 {
+				t.Errorf("expected 2 configured buckets, got %d", n)
+			}
+		}
+	}
+
+	wantDurations := map[string]uint64{
+		"method=fail,service=labels,status=404":  1,
+		"method=hello,service=labels,status=200": 1,
+	}
+	if diff := cmp.Diff(wantDurations, durations); diff != "" {
+		t.Errorf("duration mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := testutil.ToFloat64(metricsFor(reg, nil).failures.WithLabelValues("labels", "fail", "not_found")); got != 1 {
+		t.Errorf("expected 1 not_found failure, got %v", got)
+	}
+	if got := testutil.ToFloat64(metricsFor(reg, nil).inFlight.WithLabelValues("labels", "hello")); got != 0 {
+		t.Errorf("expected no requests in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(metricsFor(reg, nil).requests.WithLabelValues("labels", "hello")); got != 1 {
+		t.Errorf("expected 1 request, got %v", got)
+	}
+	if n := testutil.CollectAndCount(metricsFor(reg, nil).responseSize); n != 2 {
+		t.Errorf("expected response sizes for 2 methods, got %d", n)
+	}
+}
+
+// TestMountConflictingBuckets isn't parallel, as NewServer always uses the
+// default registerer, which it replaces.
+func TestMountConflictingBuckets(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	defaultRegisterer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = reg
+	t.Cleanup(func() { prometheus.DefaultRegisterer = defaultRegisterer })
+
+	mount := func(name string, opts ...ServiceOption) {
+		MountHandlers(log.NewNopLogger(), http.NewServeMux(), newMetricsService(name, opts...))
+	}
+
+	buckets := WithBuckets([]float64{0.5, 1})
+	mount("first", buckets)
+	mount("same", buckets)
+	mount("unset")
+	NewServer("deprecated", newMetricsService("deprecated").endpointCodecs, log.NewNopLogger())
+
+	defer func() {
+		if v := recover(); !strings.Contains(fmt.Sprint(v), "buckets") {
+			t.Errorf("expected conflicting buckets to panic, got %v", v)
+		}
+	}()
+	mount("other", WithBuckets([]float64{1, 2}))
+}
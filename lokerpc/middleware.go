@@ -0,0 +1,53 @@
+package lokerpc
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware wraps an Endpoint to add behaviour shared across endpoints, such
+// as authorisation or auditing. Responses of endpoints made with
+// MakeStandardEndpoint and MakeVoidEndpoint implement Failer, so method errors
+// are found there rather than in the returned error.
+type Middleware func(next Endpoint) Endpoint
+
+// WithMiddleware adds middleware to every endpoint of the service. Middleware
+// set with Mount wraps that set on a Service, which wraps that set with
+// EndpointMiddleware. Within each, the first middleware is the outermost.
+func WithMiddleware(mw ...Middleware) ServiceOption {
+	return func(o *serviceOptions) {
+		o.middleware = append(o.middleware[:len(o.middleware):len(o.middleware)], mw...)
+	}
+}
+
+// EndpointMiddleware adds middleware to the endpoint. It runs inside any
+// middleware set on the service.
+func EndpointMiddleware(mw ...Middleware) EndpointCodecOption {
+	return func(ec *EndpointCodec) {
+		ec.middleware = append(ec.middleware[:len(ec.middleware):len(ec.middleware)], mw...)
+	}
+}
+
+// chain wraps e in mw, with the first middleware outermost.
+func chain(e Endpoint, mw ...Middleware) Endpoint {
+	for i := len(mw) - 1; i >= 0; i-- {
+		e = mw[i](e)
+	}
+	return e
+}
+
+// CallInfo describes the call being handled.
+type CallInfo struct {
+	Service string
+	Method  string
+	// Header holds the headers of the HTTP request.
+	Header http.Header
+}
+
+type callInfoKey struct{}
+
+// CallInfoFromContext returns the CallInfo for the call being handled.
+func CallInfoFromContext(ctx context.Context) (CallInfo, bool) {
+	ci, ok := ctx.Value(callInfoKey{}).(CallInfo)
+	return ci, ok
+}
@@ -0,0 +1,86 @@
+package lokerpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	t.Parallel()
+
+	var order []string
+	record := func(name string) Middleware {
+		return func(next Endpoint) Endpoint {
+			return func(ctx context.Context, req any) (any, error) {
+				ci, _ := CallInfoFromContext(ctx)
+				order = append(order, name+":"+ci.Service+"."+ci.Method+":"+ci.Header.Get("X-Tenant"))
+				return next(ctx, req)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	Mount(log.NewNopLogger(), mux, []*Service{
+		NewService("orders", "", EndpointCodecMap{
+			"getOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error {
+				order = append(order, "endpoint")
+				return nil
+			}, "", EndpointMiddleware(record("endpoint1"), record("endpoint2"))),
+		}, WithMiddleware(record("service"))),
+	}, WithMiddleware(record("mount")))
+
+	req := httptest.NewRequest(http.MethodPost, "/rpc/orders/getOrder", strings.NewReader(`{"id":"1"}`))
+	req.Header.Set("X-Tenant", "loke")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	want := []string{
+		"mount:orders.getOrder:loke",
+		"service:orders.getOrder:loke",
+		"endpoint1:orders.getOrder:loke",
+		"endpoint2:orders.getOrder:loke",
+		"endpoint",
+	}
+	if diff := cmp.Diff(want, order); diff != "" {
+		t.Errorf("middleware order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	t.Parallel()
+
+	deny := func(Endpoint) Endpoint {
+		return func(context.Context, any) (any, error) {
+			return nil, &Error{Message: "forbidden", Category: CategoryForbidden}
+		}
+	}
+
+	var called bool
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("orders", "", EndpointCodecMap{
+		"getOrder": MakeVoidEndpointCodec(func(context.Context, getOrderRequest) error {
+			called = true
+			return nil
+		}, ""),
+	}, WithMiddleware(deny)))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/orders/getOrder", strings.NewReader(`{"id":"1"}`)))
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", rec.Code)
+	}
+	if called {
+		t.Error("expected endpoint not to be called")
+	}
+}
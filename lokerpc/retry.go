@@ -0,0 +1,178 @@
+package lokerpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/LOKE/pkg/tracing"
+)
+
+// RetryPolicy controls how failed calls are retried.
+//
+// Calls are retried when the server marks the error as Retryable, or when the
+// connection couldn't be established. If the call is idempotent (see
+// MarkIdempotent) it is also retried on other transport errors, and on 502,
+// 503 and 504 responses. If a 429 or 503 response has a Retry-After header,
+// the next attempt waits at least that long. Retries stop once the context is
+// done, or the next backoff would pass its deadline.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry. Defaults to
+	// 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff between attempts. Defaults to 5s.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the backoff grows by after each attempt.
+	// Defaults to 2.
+	Multiplier float64
+}
+
+// backoff returns the time to wait after the given attempt, with full jitter.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+
+	d := float64(initial) * math.Pow(mult, float64(attempt-1))
+	if d > float64(maxBackoff) {
+		d = float64(maxBackoff)
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// WithRetry sets the retry policy for every method.
+func WithRetry(p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithMethodRetry sets the retry policy for method, overriding WithRetry.
+func WithMethodRetry(method string, p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		m := make(map[string]RetryPolicy, len(c.methodRetry)+1)
+		for k, v := range c.methodRetry {
+			m[k] = v
+		}
+		m[method] = p
+		c.methodRetry = m
+	}
+}
+
+func (c Client) retryPolicy(method string) RetryPolicy {
+	if p, ok := c.methodRetry[method]; ok {
+		return p
+	}
+	return c.retry
+}
+
+// retryMiddleware retries failed calls according to the method's policy.
+func (c Client) retryMiddleware(next Invoker) Invoker {
+	return func(ctx context.Context, method string, args, result any) error {
+		policy := c.retryPolicy(method)
+		idempotent := isIdempotent(ctx)
+
+		for attempt := 1; ; attempt++ {
+			err := next(ctx, method, args, result)
+			if err == nil {
+				return nil
+			}
+
+			if attempt >= policy.MaxAttempts || !shouldRetry(ctx, err, idempotent) || !sleepBackoff(ctx, retryBackoff(policy, attempt, err)) {
+				return err
+			}
+
+			if span := tracing.SpanFromContext(ctx); span != nil {
+				span.SetAttribute("rpc.retries", strconv.Itoa(attempt))
+			}
+		}
+	}
+}
+
+type idempotentKey struct{}
+
+// MarkIdempotent returns a copy of ctx that marks calls made with it as
+// idempotent, allowing them to be retried on more kinds of failures.
+// Generated clients use it for methods the server declares Idempotent.
+func MarkIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	v, _ := ctx.Value(idempotentKey{}).(bool)
+	return v
+}
+
+// shouldRetry reports whether a call that failed with err can be retried.
+func shouldRetry(ctx context.Context, err error, idempotent bool) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		if rpcErr.Retryable {
+			return true
+		}
+		switch rpcErr.Category {
+		case CategoryUnavailable, CategoryTimeout:
+			return idempotent
+		}
+		return false
+	}
+
+	// The request was never sent if we couldn't connect
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	return idempotent
+}
+
+// retryBackoff returns the time to wait after the given attempt failed with
+// err, which is at least as long as the server asked for.
+func retryBackoff(p RetryPolicy, attempt int, err error) time.Duration {
+	d := p.backoff(attempt)
+
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) && rpcErr.retryAfter > d {
+		d = rpcErr.retryAfter
+	}
+	return d
+}
+
+// sleepBackoff waits before the next attempt, returning false if ctx is done
+// or its deadline is too close to make another attempt.
+func sleepBackoff(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,220 @@
+package lokerpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientRetry(t *testing.T) {
+	t.Parallel()
+
+	fastRetry := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	tests := []struct {
+		name       string
+		failures   int
+		status     int
+		retryAfter string
+		body       *Error
+		idempotent bool
+		opts       []ClientOption
+		timeout    time.Duration
+		wantCalls  int32
+		wantErr    bool
+	}{
+		{
+			name:       "retries idempotent call on 503",
+			failures:   2,
+			status:     http.StatusServiceUnavailable,
+			body:       &Error{Message: "unavailable"},
+			idempotent: true,
+			opts:       []ClientOption{WithRetry(fastRetry)},
+			wantCalls:  3,
+		},
+		{
+			name:       "gives up after max attempts",
+			failures:   5,
+			status:     http.StatusBadGateway,
+			body:       &Error{Message: "bad gateway"},
+			idempotent: true,
+			opts:       []ClientOption{WithRetry(fastRetry)},
+			wantCalls:  3,
+			wantErr:    true,
+		},
+		{
+			name:      "doesn't retry non idempotent call on 504",
+			failures:  1,
+			status:    http.StatusGatewayTimeout,
+			body:      &Error{Message: "timeout"},
+			opts:      []ClientOption{WithRetry(fastRetry)},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "retries non idempotent call when server signals retryable",
+			failures:  1,
+			status:    http.StatusTooManyRequests,
+			body:      &Error{Message: "slow down", Retryable: true},
+			opts:      []ClientOption{WithRetry(fastRetry)},
+			wantCalls: 2,
+		},
+		{
+			name:       "doesn't retry client errors",
+			failures:   1,
+			status:     http.StatusBadRequest,
+			body:       &Error{Message: "bad"},
+			idempotent: true,
+			opts:       []ClientOption{WithRetry(fastRetry)},
+			wantCalls:  1,
+			wantErr:    true,
+		},
+		{
+			name:       "no retries by default",
+			failures:   1,
+			status:     http.StatusServiceUnavailable,
+			body:       &Error{Message: "unavailable"},
+			idempotent: true,
+			wantCalls:  1,
+			wantErr:    true,
+		},
+		{
+			name:       "method policy overrides client policy",
+			failures:   1,
+			status:     http.StatusServiceUnavailable,
+			body:       &Error{Message: "unavailable"},
+			idempotent: true,
+			opts:       []ClientOption{WithRetry(fastRetry), WithMethodRetry("hello", RetryPolicy{MaxAttempts: 1})},
+			wantCalls:  1,
+			wantErr:    true,
+		},
+		{
+			name:       "stops when backoff would pass the deadline",
+			failures:   1,
+			status:     http.StatusServiceUnavailable,
+			body:       &Error{Message: "unavailable"},
+			idempotent: true,
+			opts:       []ClientOption{WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 1})},
+			timeout:    time.Second,
+			wantCalls:  1,
+			wantErr:    true,
+		},
+		{
+			name:       "stops when retry after would pass the deadline",
+			failures:   1,
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "60",
+			body:       &Error{Message: "unavailable"},
+			idempotent: true,
+			opts:       []ClientOption{WithRetry(fastRetry)},
+			timeout:    time.Second,
+			wantCalls:  1,
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(atomic.AddInt32(&calls, 1)) > tc.failures {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				w.Header().Set("Content-Type", ContentType)
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.body)
+			}))
+			defer srv.Close()
+
+			ctx := context.Background()
+			if tc.idempotent {
+				ctx = MarkIdempotent(ctx)
+			}
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			err := NewClient(srv.URL, tc.opts...).DoRequest(ctx, "hello", deadlineRequest{}, nil)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("DoRequest() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got := atomic.LoadInt32(&calls); got != tc.wantCalls {
+				t.Errorf("expected %d calls, got %d", tc.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestClientRetryDialError(t *testing.T) {
+	t.Parallel()
+
+	// Nothing listens on port 1, so every attempt fails to connect, which is
+	// always safe to retry
+	var attempts int32
+	c := NewClient("http://127.0.0.1:1",
+		WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+		WithHTTPClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&attempts, 1)
+			return http.DefaultTransport.RoundTrip(r)
+		})}),
+	)
+
+	if err := c.DoRequest(context.Background(), "hello", deadlineRequest{}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	p := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	if d := retryBackoff(p, 1, &Error{retryAfter: time.Minute}); d != time.Minute {
+		t.Errorf("expected to wait for retry after, got %v", d)
+	}
+	if d := retryBackoff(p, 1, &Error{}); d > time.Millisecond {
+		t.Errorf("expected policy backoff, got %v", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for v, want := range map[string]time.Duration{
+		"":                  0,
+		"3":                 3 * time.Second,
+		"-1":                0,
+		"soon":              0,
+		"99999999999999999": 0,
+		now.Add(time.Minute).Format(http.TimeFormat):  time.Minute,
+		now.Add(-time.Minute).Format(http.TimeFormat): 0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -4,11 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"reflect"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
+	lokelog "github.com/LOKE/pkg/log"
+	"github.com/LOKE/pkg/requestid"
+	"github.com/LOKE/pkg/tracing"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	jtd "github.com/jsontypedef/json-typedef-go"
@@ -18,30 +26,11 @@ import (
 const (
 	// ContentType defines the content type to be served.
 	ContentType = "application/json; charset=utf-8"
-)
-
-var latency *prometheus.HistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-	Name: "http_rpc_request_duration_seconds",
-	Help: "Duration of rpc requests",
-}, []string{"handler"})
-
-var count *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
-	Name: "http_rpc_requests_total",
-	Help: "The total number of rpc requests received",
-}, []string{"handler"})
 
-var failures *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
-	Name: "http_rpc_failures_total",
-	Help: "The total number of rpc failures received",
-}, []string{"handler", "type"})
-
-// should really avoid init,
-// works for now
-func init() {
-	prometheus.MustRegister(latency)
-	prometheus.MustRegister(count)
-	prometheus.MustRegister(failures)
-}
+	// DefaultMethodTimeout is the timeout applied to endpoints that don't set
+	// one with MethodTimeout.
+	DefaultMethodTimeout = 60 * time.Second
+)
 
 type DecodeRequestFunc func(context.Context, json.RawMessage) (request interface{}, err error)
 type EncodeResponseFunc func(context.Context, interface{}) (response json.RawMessage, err error)
@@ -60,15 +49,83 @@ type Service struct {
 	Help string
 
 	endpointCodecs EndpointCodecMap
+	opts           []ServiceOption
 }
 
 // NewService creates a new Service
-func NewService(name, help string, ecm EndpointCodecMap) *Service {
+func NewService(name, help string, ecm EndpointCodecMap, opts ...ServiceOption) *Service {
 	return &Service{
 		Name:           name,
 		Help:           help,
 		endpointCodecs: ecm,
+		opts:           opts,
+	}
+}
+
+// ServiceOption configures how a Service is mounted. Options can be set per
+// Service with NewService, or for every service with Mount. Options set on a
+// Service take precedence.
+type ServiceOption func(*serviceOptions)
+
+type serviceOptions struct {
+	registerer    prometheus.Registerer
+	buckets       []float64
+	middleware    []Middleware
+	decode        DecodeOptions
+	authenticator Authenticator
+	batch         *BatchOptions
+	requestID     *requestid.Policy
+}
+
+// WithRegisterer sets the registerer the rpc metrics are registered with.
+// Defaults to prometheus.DefaultRegisterer.
+func WithRegisterer(reg prometheus.Registerer) ServiceOption {
+	return func(o *serviceOptions) {
+		o.registerer = reg
+	}
+}
+
+// WithBuckets sets the buckets of the request duration histogram. As metrics
+// are shared per registerer, every service mounted on a registerer must use
+// the same buckets, so it's best given as a mount option alongside
+// WithRegisterer. Mounting a service with buckets that conflict with those
+// already registered panics. Defaults to prometheus.DefBuckets.
+func WithBuckets(buckets []float64) ServiceOption {
+	return func(o *serviceOptions) {
+		o.buckets = buckets
+	}
+}
+
+// WithRequestIDPolicy sets the policy inbound X-Request-ID headers are
+// accepted with. Defaults to requestid.DefaultPolicy, as it was when the
+// service was mounted.
+func WithRequestIDPolicy(p requestid.Policy) ServiceOption {
+	return func(o *serviceOptions) {
+		o.requestID = &p
+	}
+}
+
+// requestIDMiddleware wraps next so every request carries a request id,
+// accepted according to the policy set by o.
+func (o serviceOptions) requestIDMiddleware(next http.Handler) http.Handler {
+	if o.requestID != nil {
+		return o.requestID.Middleware(next)
+	}
+	return requestid.Middleware(next)
+}
+
+// options resolves the options for s, applying the mount wide options first.
+func (s *Service) options(mountOpts []ServiceOption) serviceOptions {
+	o := serviceOptions{
+		registerer: prometheus.DefaultRegisterer,
+	}
+	for _, opt := range mountOpts {
+		opt(&o)
+	}
+	for _, opt := range s.opts {
+		opt(&o)
 	}
+	return o
 }
 
 // Endpoint is an abstract rpc endpoint
@@ -85,6 +142,27 @@ type EndpointCodec struct {
 	responseType     reflect.Type
 	errOnNilResponse bool
 	voidResponse     bool
+	timeout          time.Duration
+	idempotent       bool
+	multiArg         bool
+	middleware       []Middleware
+	decodeOpts       *DecodeOptions
+	scopes           []string
+	authenticator    Authenticator
+}
+
+func (ec EndpointCodec) decodeOptions() DecodeOptions {
+	if ec.decodeOpts != nil {
+		return *ec.decodeOpts
+	}
+	return DecodeOptions{}
+}
+
+func (ec EndpointCodec) methodTimeout() time.Duration {
+	if ec.timeout > 0 {
+		return ec.timeout
+	}
+	return DefaultMethodTimeout
 }
 
 // EndpointCodecMap maps the Request.Method to the proper EndpointCodec
@@ -93,6 +171,7 @@ type EndpointCodecMap map[string]EndpointCodec
 type Meta struct {
 	ServiceName string                `json:"serviceName"`
 	MultiArg    bool                  `json:"multiArg"`
+	Batch       bool                  `json:"batch,omitempty"`
 	Help        string                `json:"help"`
 	Interfaces  []EndpointMeta        `json:"interfaces"`
 	Definitions map[string]jtd.Schema `json:"definitions,omitempty"`
@@ -102,6 +181,9 @@ type EndpointMeta struct {
 	MethodName      string      `json:"methodName"`
 	ParamNames      []string    `json:"paramNames"`
 	MethodTimeout   int         `json:"methodTimeout"`
+	Idempotent      bool        `json:"idempotent,omitempty"`
+	MultiArg        bool        `json:"multiArg,omitempty"`
+	Scopes          []string    `json:"scopes,omitempty"`
 	Help            string      `json:"help"`
 	RequestTypeDef  *jtd.Schema `json:"requestTypeDef,omitempty"`
 	ResponseTypeDef *jtd.Schema `json:"responseTypeDef,omitempty"`
@@ -119,10 +201,20 @@ type standardResponse struct {
 func (r standardResponse) Result() any   { return r.Res }
 func (r standardResponse) Failed() error { return r.Err }
 
-func DecodeRequest[Req any](_ context.Context, msg json.RawMessage) (any, error) {
+// DecodeRequest decodes msg into a Req, following the DecodeOptions in ctx.
+func DecodeRequest[Req any](ctx context.Context, msg json.RawMessage) (any, error) {
+	do := DecodeOptionsFromContext(ctx)
+
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	if do.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if do.UseNumber {
+		dec.UseNumber()
+	}
+
 	var req Req
-	err := json.Unmarshal(msg, &req)
-	if err != nil {
+	if err := dec.Decode(&req); err != nil {
 		return nil, err
 	}
 	return req, nil
@@ -148,6 +240,16 @@ func MakeVoidEndpoint[Req any](method VoidMethod[Req]) Endpoint {
 	}
 }
 
+// Logger returns the per request logger for the endpoint handling ctx. It
+// carries the rpc_service, method, request_id and tracing keys. If ctx isn't
+// from a lokerpc handler a no-op logger is returned.
+func Logger(ctx context.Context) log.Logger {
+	if l, ok := lokelog.FromContext(ctx); ok {
+		return l
+	}
+	return log.NewNopLogger()
+}
+
 type EndpointCodecOption func(*EndpointCodec)
 
 // MakeStandardEndpointCodec
@@ -201,27 +303,71 @@ func NoNilResponse() EndpointCodecOption {
 	}
 }
 
+// MethodTimeout sets the maximum time the endpoint is given to respond. The
+// deadline a caller sends is capped to it. Defaults to DefaultMethodTimeout.
+func MethodTimeout(d time.Duration) EndpointCodecOption {
+	return func(ec *EndpointCodec) {
+		ec.timeout = d
+	}
+}
+
+// Idempotent declares that calling the endpoint more than once has the same
+// effect as calling it once. It is advertised in the metadata, so generated
+// clients know the method is safe to retry.
+func Idempotent() EndpointCodecOption {
+	return func(ec *EndpointCodec) {
+		ec.idempotent = true
+	}
+}
+
+// MultiArg allows the endpoint to be called with an array of positional
+// params, in the order of its ParamNames, as well as an object. It is
+// advertised in the metadata, so generated clients use positional params.
+func MultiArg() EndpointCodecOption {
+	return func(ec *EndpointCodec) {
+		ec.multiArg = true
+	}
+}
+
+// multiArg reports whether every endpoint of ecm accepts positional params,
+// in which case the service as a whole is advertised as MultiArg.
+func multiArg(ecm EndpointCodecMap) bool {
+	for _, ec := range ecm {
+		if !ec.multiArg {
+			return false
+		}
+	}
+	return len(ecm) > 0
+}
+
 // NewServer constructs a new server, which implements http.Handler.
 //
 // Deprecated: Use the MountHandlers with Services instead
 func NewServer(serviceName string, ecm EndpointCodecMap, logger log.Logger) http.Handler {
-	ecm = wrapMetrics(serviceName, ecm)
+	m := metricsFor(prometheus.DefaultRegisterer, nil)
 	mux := http.NewServeMux()
 	meta := Meta{
 		ServiceName: serviceName,
-		MultiArg:    false,
+		MultiArg:    multiArg(ecm),
 		Help:        "",
 	}
 
 	for methodName, ec := range ecm {
 		l := log.With(logger, "rpc_service", serviceName, "method", methodName)
 
-		mux.HandleFunc("/"+methodName, makeHandler(l, ec))
+		ec.Endpoint = chain(ec.Endpoint, ec.middleware...)
+
+		h := m.instrument(serviceName, methodName, makeHandler(l, serviceName, methodName, ec))
+		h = tracing.Middleware(serviceName+"."+methodName, h)
+		mux.Handle("/"+methodName, requestid.Middleware(h))
 		meta.Interfaces = append(meta.Interfaces, EndpointMeta{
 			MethodName:    methodName,
-			MethodTimeout: 60000,
+			MethodTimeout: int(ec.methodTimeout().Milliseconds()),
 			Help:          ec.Help,
 			ParamNames:    ec.ParamNames,
+			Idempotent:    ec.idempotent,
+			MultiArg:      ec.multiArg,
+			Scopes:        ec.scopes,
 		})
 	}
 
@@ -238,7 +384,7 @@ func NewServer(serviceName string, ecm EndpointCodecMap, logger log.Logger) http
 		case "/", "":
 			if r.Method == "GET" {
 				if _, err := rw.Write(metab); err != nil {
-					panic(err)
+					level.Error(logger).Log("msg", "failed to write rpc metadata", "err", err)
 				}
 			} else {
 				http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
@@ -262,30 +408,41 @@ type Mux interface {
 //
 //	GET /rpc
 //	GET /rpc/<service>
+//
+// and batches of calls from POST /rpc/<service>, if enabled with WithBatch.
 func MountHandlers(logger log.Logger, mux Mux, services ...*Service) {
+	Mount(logger, mux, services)
+}
+
+// Mount is like MountHandlers, with options applied to every service.
+func Mount(logger log.Logger, mux Mux, services []*Service, opts ...ServiceOption) {
 	rootmeta := RootMeta{}
 
 	for _, service := range services {
-		ecm := wrapMetrics(service.Name, service.endpointCodecs)
+		o := service.options(opts)
 
 		defs := map[reflect.Type]*NamedSchema{}
 
 		meta := &Meta{
 			ServiceName: service.Name,
-			MultiArg:    false,
+			MultiArg:    multiArg(service.endpointCodecs),
+			Batch:       o.batch != nil,
 			Help:        service.Help,
 		}
 
-		for methodName, ec := range ecm {
-			l := log.With(logger, "rpc_service", service.Name, "method", methodName)
+		handlers := service.handlers(logger, o)
 
-			mux.Handle("/rpc/"+service.Name+"/"+methodName, makeHandler(l, ec))
+		for methodName, ec := range service.endpointCodecs {
+			mux.Handle("/rpc/"+service.Name+"/"+methodName, handlers[methodName])
 
 			endMeta := EndpointMeta{
 				MethodName:    methodName,
-				MethodTimeout: 60000,
+				MethodTimeout: int(ec.methodTimeout().Milliseconds()),
 				Help:          ec.Help,
 				ParamNames:    ec.ParamNames,
+				Idempotent:    ec.idempotent,
+				MultiArg:      ec.multiArg,
+				Scopes:        ec.scopes,
 			}
 
 			if ec.requestType != nil {
@@ -308,23 +465,65 @@ func MountHandlers(logger log.Logger, mux Mux, services ...*Service) {
 
 		meta.Definitions = TypeDefs(defs)
 
-		// service meta endpoint
-		mux.Handle("/rpc/"+service.Name, newMetaHandler(meta))
+		// service meta endpoint, which also serves batches if enabled
+		sl := log.With(logger, "rpc_service", service.Name)
+		var sh http.Handler = newMetaHandler(sl, meta)
+		if o.batch != nil {
+			sh = withBatch(sh, newBatchHandler(sl, service.Name, handlers, o))
+		}
+		mux.Handle("/rpc/"+service.Name, sh)
 
 		rootmeta.Services = append(rootmeta.Services, meta)
 	}
 
 	// root meta endpoint
-	mux.Handle("/rpc", newMetaHandler(rootmeta))
+	mux.Handle("/rpc", newMetaHandler(logger, rootmeta))
+}
+
+// handlers builds the handler for each method of s, with the middleware,
+// decoding, authentication and instrumentation set by o. They are shared by
+// every transport a service is mounted with.
+func (s *Service) handlers(logger log.Logger, o serviceOptions) map[string]http.Handler {
+	m := metricsFor(o.registerer, o.buckets)
+	handlers := make(map[string]http.Handler, len(s.endpointCodecs))
+
+	for methodName, ec := range s.endpointCodecs {
+		l := log.With(logger, "rpc_service", s.Name, "method", methodName)
+
+		ec.Endpoint = chain(chain(ec.Endpoint, ec.middleware...), o.middleware...)
+		do := o.decode
+		if ec.decodeOpts != nil {
+			do = ec.decodeOpts.merge(o.decode)
+		}
+		ec.decodeOpts = &do
+		ec.authenticator = o.authenticator
+
+		h := m.instrument(s.Name, methodName, makeHandler(l, s.Name, methodName, ec))
+		h = tracing.Middleware(s.Name+"."+methodName, h)
+		handlers[methodName] = o.requestIDMiddleware(h)
+	}
+
+	return handlers
 }
 
-func newMetaHandler(meta any) http.HandlerFunc {
+// withBatch serves POST requests with batch, and everything else with meta.
+func withBatch(meta, batch http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			batch.ServeHTTP(rw, r)
+			return
+		}
+		meta.ServeHTTP(rw, r)
+	})
+}
+
+func newMetaHandler(logger log.Logger, meta any) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
 			rw.Header().Set("Content-Type", ContentType)
 			rw.WriteHeader(http.StatusOK)
 			if err := json.NewEncoder(rw).Encode(meta); err != nil {
-				panic(err)
+				level.Error(logger).Log("msg", "failed to encode rpc metadata", "err", err)
 			}
 		} else {
 			http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
@@ -332,20 +531,95 @@ func newMetaHandler(meta any) http.HandlerFunc {
 	}
 }
 
+// FieldNames returns the JSON names of the fields of the struct i, in order.
+// It follows the rules of encoding/json, so unexported and "-" fields are
+// skipped, the fields of embedded structs are promoted, and of conflicting
+// names only the shallowest (or tagged) field is kept.
 func FieldNames(i interface{}) []string {
-	pm := []string{}
-	t := reflect.TypeOf(i)
+	type field struct {
+		name   string
+		depth  int
+		tagged bool
+	}
+
+	var fields []field
+	path := map[reflect.Type]bool{}
+
+	var walk func(t reflect.Type, depth int)
+	walk = func(t reflect.Type, depth int) {
+		path[t] = true
+		defer delete(path, t)
 
-	for n := 0; n < t.NumField(); n++ {
-		f := t.Field(n)
-		name, _ := parseTag(f.Tag.Get("json"))
-		if name == "-" {
-			continue
+		for n := 0; n < t.NumField(); n++ {
+			f := t.Field(n)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if f.Anonymous {
+				if !f.IsExported() && ft.Kind() != reflect.Struct {
+					continue
+				}
+			} else if !f.IsExported() {
+				continue
+			}
+
+			name, _ := parseTag(tag)
+			if name == "" && f.Anonymous && ft.Kind() == reflect.Struct {
+				if !path[ft] {
+					walk(ft, depth+1)
+				}
+				continue
+			}
+
+			tagged := name != ""
+			if !tagged {
+				name = f.Name
+			}
+			fields = append(fields, field{name: name, depth: depth, tagged: tagged})
 		}
-		if name == "" {
-			name = f.Name
+	}
+	walk(reflect.TypeOf(i), 0)
+
+	// Keep the dominant field for each name, as encoding/json does
+	byName := map[string][]int{}
+	for i, f := range fields {
+		byName[f.name] = append(byName[f.name], i)
+	}
+	dominant := func(idxs []int) int {
+		var shallowest, tagged []int
+		for _, i := range idxs {
+			if len(shallowest) > 0 && fields[i].depth > fields[shallowest[0]].depth {
+				continue
+			}
+			if len(shallowest) > 0 && fields[i].depth < fields[shallowest[0]].depth {
+				shallowest, tagged = nil, nil
+			}
+			shallowest = append(shallowest, i)
+			if fields[i].tagged {
+				tagged = append(tagged, i)
+			}
+		}
+		switch {
+		case len(shallowest) == 1:
+			return shallowest[0]
+		case len(tagged) == 1:
+			return tagged[0]
+		default:
+			return -1
+		}
+	}
+
+	pm := []string{}
+	for i, f := range fields {
+		if dominant(byName[f.name]) == i {
+			pm = append(pm, f.name)
 		}
-		pm = append(pm, name)
 	}
 	return pm
 }
@@ -358,103 +632,227 @@ func parseTag(tag string) (string, bool) {
 	return tag, false
 }
 
-func wrapMetrics(serviceName string, ecm EndpointCodecMap) EndpointCodecMap {
-	newECM := EndpointCodecMap{}
-
-	for methodName, ec := range ecm {
-		handlerName := serviceName + "." + methodName
-
-		wec := ec
-		wec.Endpoint = wrapEndpoint(handlerName, ec.Endpoint)
-
-		newECM[methodName] = wec
-	}
-
-	return newECM
-}
+func makeHandler(logger log.Logger, service, method string, ec EndpointCodec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "405 must POST", http.StatusMethodNotAllowed)
+			return
+		}
 
-func wrapEndpoint(handlerName string, e Endpoint) Endpoint {
-	c := count.WithLabelValues(handlerName)
-	l := latency.WithLabelValues(handlerName)
+		logger := lokelog.WithContext(r.Context(), logger)
+		logErr := level.Error(logger).Log
 
-	return func(ctx context.Context, request interface{}) (result interface{}, err error) {
-		t := prometheus.NewTimer(l)
-		defer t.ObserveDuration()
 		defer func() {
-			if err != nil {
-				failures.WithLabelValues(handlerName, "unknown").Inc()
-			} else if e, ok := result.(Failer); ok && e.Failed() != nil {
-				failures.WithLabelValues(handlerName, "unknown").Inc()
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
 			}
+
+			rpcErr := &Error{Message: "internal server error", Category: CategoryInternal}
+			logErr("msg", "endpoint panic", "panic", fmt.Sprint(v), "stack", string(debug.Stack()), "error_id", ensureInstance(rpcErr))
+			writeError(w, http.StatusInternalServerError, rpcErr)
+			setFailureType(w, "panic")
 		}()
-		c.Inc()
-		return e(ctx, request)
-	}
-}
+		deadline, err := requestDeadline(r, ec.methodTimeout())
+		if err != nil {
+			writeBadReq(w, "%v", err)
+			return
+		}
+
+		if !time.Now().Before(deadline) {
+			rpcErr := asError(ErrDeadlineExceeded)
+			logErr("msg", "request deadline already exceeded", "error_id", ensureInstance(rpcErr))
+			writeError(w, CategoryTimeout.StatusCode(), rpcErr)
+			return
+		}
 
-func makeHandler(logger log.Logger, ec EndpointCodec) http.HandlerFunc {
-	logErr := level.Error(logger).Log
+		ctx := lokelog.NewContext(r.Context(), logger)
+		ctx = context.WithValue(ctx, callInfoKey{}, CallInfo{Service: service, Method: method, Header: r.Header})
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "405 must POST", http.StatusMethodNotAllowed)
+		principal, err := authorise(r, ec.authenticator, ec.scopes)
+		if err != nil {
+			rpcErr, status := classifyError(err, CategoryUnauthorised)
+			logErr("msg", "authorisation failed", "err", err, "type", rpcErr.Category, "error_id", ensureInstance(rpcErr))
+			writeError(w, status, rpcErr)
 			return
 		}
-		ctx := r.Context()
+		if principal != nil {
+			ctx = NewPrincipalContext(ctx, principal)
+			logger = log.With(logger, "principal", principal.Subject)
+			ctx = lokelog.NewContext(ctx, logger)
+			logErr = level.Error(logger).Log
+		}
+
+		do := ec.decodeOptions()
+		ctx = context.WithValue(ctx, decodeOptionsKey{}, do)
 
 		// Decode the body into an  object
-		var jsonParams json.RawMessage
-		err := json.NewDecoder(r.Body).Decode(&jsonParams)
+		jsonParams, err := readParams(r.Body, r.ContentLength, do)
+		if errors.Is(err, errRequestTooLarge) {
+			writeError(w, CategoryTooLarge.StatusCode(), asError(errRequestTooLarge))
+			return
+		}
 		if err != nil {
-			writeBadReq(w, "JSON could not be decoded: %v", err)
+			writeInvalidParams(w, "JSON could not be decoded: %v", err)
 			return
 		}
 
+		if ec.multiArg && bytes.HasPrefix(jsonParams, []byte("[")) {
+			jsonParams, err = namedParams(jsonParams, ec.ParamNames)
+			if err != nil {
+				writeInvalidParams(w, "%v", err)
+				return
+			}
+		}
+
 		// Decode the JSON "params"
 		reqParams, err := ec.Decode(ctx, jsonParams)
 		if err != nil {
-			writeBadReq(w, "Invalid request: %v", err)
+			writeInvalidParams(w, "Invalid request: %v", err)
 			return
 		}
 
 		// Call the Endpoint with the params
 		result, err := ec.Endpoint(ctx, reqParams)
-		if err != nil {
-			logErr("msg", "endpoint error", "err", err)
-			writeBadReq(w, "Endpoint error: %v", err)
+
+		// A result that made it back is served even if the deadline has just
+		// passed, as the work has been done
+		failed := err
+		if e, ok := result.(Failer); ok && failed == nil {
+			failed = e.Failed()
+		}
+		if failed != nil && ctx.Err() == context.DeadlineExceeded {
+			rpcErr := asError(ErrDeadlineExceeded)
+			logErr("msg", "request deadline exceeded", "error_id", ensureInstance(rpcErr))
+			writeError(w, CategoryTimeout.StatusCode(), rpcErr)
 			return
 		}
 
-		status := http.StatusOK
+		if err != nil {
+			setRetryAfter(w, err)
+			rpcErr, status := classifyError(err, CategoryInternal)
+			errorLog(logger, rpcErr)("msg", "endpoint error", "err", err, "type", rpcErr.Category, "error_id", ensureInstance(rpcErr))
+			writeError(w, status, rpcErr)
+			return
+		}
 
 		if e, ok := result.(Failer); ok && e.Failed() != nil {
-			logErr("err", e.Failed())
-
-			status = http.StatusBadRequest
-			result = struct {
-				Message string `json:"message"`
-			}{e.Failed().Error()}
-		} else {
-			if r, ok := result.(Resulter); ok {
-				result = r.Result()
-			}
+			setRetryAfter(w, e.Failed())
+			rpcErr, status := classifyError(e.Failed(), CategoryBadRequest)
+			errorLog(logger, rpcErr)("err", e.Failed(), "type", rpcErr.Category, "error_id", ensureInstance(rpcErr))
+			writeError(w, status, rpcErr)
+			return
+		}
 
-			if result == nil && ec.errOnNilResponse && !ec.voidResponse {
-				logErr("err", "unexpected nil response")
+		if r, ok := result.(Resulter); ok {
+			result = r.Result()
+		}
 
-				status = http.StatusInternalServerError
-				result = struct {
-					Message string `json:"message"`
-				}{"unexpected nil response"}
-			}
+		if result == nil && ec.errOnNilResponse && !ec.voidResponse {
+			rpcErr := &Error{Message: "unexpected nil response", Category: CategoryInternal}
+			logErr("err", "unexpected nil response", "error_id", ensureInstance(rpcErr))
+			writeError(w, http.StatusInternalServerError, rpcErr)
+			return
 		}
 
 		w.Header().Set("Content-Type", ContentType)
-		w.WriteHeader(status)
+		w.WriteHeader(http.StatusOK)
 		_ = json.NewEncoder(w).Encode(result)
 	}
 }
 
+// requestDeadline returns the deadline for r, capped to timeout. The remaining
+// budget in X-Request-Timeout is preferred over the absolute time in
+// X-Request-Deadline, as it isn't affected by clock skew between hosts.
+func requestDeadline(r *http.Request, timeout time.Duration) (time.Time, error) {
+	now := time.Now()
+	deadline := now.Add(timeout)
+
+	var d time.Time
+	if h := r.Header.Get("X-Request-Timeout"); h != "" {
+		ms, err := strconv.ParseInt(h, 10, 64)
+		if err != nil || ms < 0 {
+			return time.Time{}, fmt.Errorf("Invalid X-Request-Timeout: %q", h)
+		}
+		d = now.Add(budgetDuration(ms))
+	} else if h := r.Header.Get("X-Request-Deadline"); h != "" {
+		var err error
+		d, err = time.Parse(time.RFC3339Nano, h)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid X-Request-Deadline: %v", err)
+		}
+	}
+
+	if !d.IsZero() && d.Before(deadline) {
+		deadline = d
+	}
+
+	return deadline, nil
+}
+
+// budgetDuration converts an X-Request-Timeout budget in milliseconds to a
+// Duration, saturating rather than overflowing for huge budgets.
+func budgetDuration(ms int64) time.Duration {
+	if ms > int64(math.MaxInt64/time.Millisecond) {
+		return math.MaxInt64
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// classifyError converts err to an *Error with its Category set, and returns
+// it along with the HTTP status it should be served with.
+func classifyError(err error, def Category) (*Error, int) {
+	cat, status := classify(err, def)
+	rpcErr := asError(err)
+	rpcErr.Category = cat
+	return rpcErr, status
+}
+
+// ensureInstance assigns an instance id to e if it doesn't already have one,
+// and returns it.
+func ensureInstance(e *Error) string {
+	if e.Instance == "" {
+		e.Instance = newInstanceID()
+	}
+	return e.Instance
+}
+
+// errorLog returns the log func for an endpoint error. Rejections by a
+// limiter are expected under load, so they are logged as warnings.
+func errorLog(logger log.Logger, rpcErr *Error) func(keyvals ...interface{}) error {
+	if rpcErr.Category == CategoryTooManyRequests {
+		return level.Warn(logger).Log
+	}
+	return level.Error(logger).Log
+}
+
+// setRetryAfter sets the Retry-After header if err says when to retry.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) {
+		secs := int64(math.Ceil(ra.RetryAfter().Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, e *Error) {
+	setFailureType(w, string(e.Category))
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+func writeInvalidParams(w http.ResponseWriter, format string, a ...interface{}) {
+	e := *ErrInvalidParams
+	e.Message = fmt.Sprintf(format, a...)
+	writeError(w, http.StatusBadRequest, &e)
+}
+
 func writeBadReq(w http.ResponseWriter, format string, a ...interface{}) {
-	http.Error(w, fmt.Sprintf(format+"\n", a...), http.StatusBadRequest)
+	writeError(w, http.StatusBadRequest, &Error{Message: fmt.Sprintf(format, a...), Expose: true, Category: CategoryBadRequest})
 }
@@ -0,0 +1,463 @@
+package lokerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LOKE/pkg/requestid"
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type deadlineRequest struct{}
+
+func TestHandlerDeadline(t *testing.T) {
+	t.Parallel()
+
+	headerDeadline := time.Now().Add(time.Second).UTC()
+
+	tests := []struct {
+		name         string
+		header       string
+		budget       string
+		timeout      time.Duration
+		sleep        time.Duration
+		ignoreCtx    bool
+		wantStatus   int
+		wantCalled   bool
+		wantDeadline func(time.Time) bool
+	}{
+		{
+			name:       "uses caller deadline when earlier",
+			header:     headerDeadline.Format(time.RFC3339Nano),
+			timeout:    time.Minute,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantDeadline: func(d time.Time) bool {
+				return d.Equal(headerDeadline)
+			},
+		},
+		{
+			name:       "caps caller deadline to method timeout",
+			header:     time.Now().Add(time.Hour).Format(time.RFC3339Nano),
+			timeout:    time.Second,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantDeadline: func(d time.Time) bool {
+				return time.Until(d) <= time.Second
+			},
+		},
+		{
+			name:       "prefers remaining budget over skewed deadline",
+			header:     time.Now().Add(-time.Hour).Format(time.RFC3339Nano),
+			budget:     "1000",
+			timeout:    time.Minute,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantDeadline: func(d time.Time) bool {
+				return time.Until(d) <= time.Second
+			},
+		},
+		{
+			name:       "caps huge budget to method timeout",
+			budget:     "10000000000000",
+			timeout:    time.Second,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantDeadline: func(d time.Time) bool {
+				return time.Until(d) <= time.Second
+			},
+		},
+		{
+			name:       "caps max budget to method timeout",
+			budget:     "9223372036854775807",
+			timeout:    time.Second,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+			wantDeadline: func(d time.Time) bool {
+				return time.Until(d) <= time.Second
+			},
+		},
+		{
+			name:       "rejects invalid budget",
+			budget:     "-5",
+			timeout:    time.Minute,
+			wantStatus: http.StatusBadRequest,
+			wantCalled: false,
+		},
+		{
+			name:       "rejects expired deadline",
+			header:     time.Now().Add(-time.Second).Format(time.RFC3339Nano),
+			timeout:    time.Minute,
+			wantStatus: http.StatusGatewayTimeout,
+			wantCalled: false,
+		},
+		{
+			name:       "rejects invalid deadline",
+			header:     "tomorrow",
+			timeout:    time.Minute,
+			wantStatus: http.StatusBadRequest,
+			wantCalled: false,
+		},
+		{
+			name:       "times out mid call",
+			timeout:    10 * time.Millisecond,
+			sleep:      50 * time.Millisecond,
+			wantStatus: http.StatusGatewayTimeout,
+			wantCalled: true,
+		},
+		{
+			name:       "completes just past deadline",
+			timeout:    10 * time.Millisecond,
+			sleep:      50 * time.Millisecond,
+			ignoreCtx:  true,
+			wantStatus: http.StatusOK,
+			wantCalled: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				called   bool
+				deadline time.Time
+			)
+
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, NewService("deadline", "", EndpointCodecMap{
+				"wait": MakeVoidEndpointCodec(func(ctx context.Context, _ deadlineRequest) error {
+					called = true
+					deadline, _ = ctx.Deadline()
+					time.Sleep(tc.sleep)
+					if tc.ignoreCtx {
+						return nil
+					}
+					return ctx.Err()
+				}, "", MethodTimeout(tc.timeout)),
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/rpc/deadline/wait", strings.NewReader("{}"))
+			if tc.header != "" {
+				req.Header.Set("X-Request-Deadline", tc.header)
+			}
+			if tc.budget != "" {
+				req.Header.Set("X-Request-Timeout", tc.budget)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if called != tc.wantCalled {
+				t.Errorf("expected called %v, got %v", tc.wantCalled, called)
+			}
+			if tc.wantDeadline != nil && !tc.wantDeadline(deadline) {
+				t.Errorf("unexpected endpoint deadline %v", deadline)
+			}
+		})
+	}
+}
+
+func TestMetaMethodTimeout(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("timeouts", "", EndpointCodecMap{
+		"fast": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error { return nil }, "", MethodTimeout(250*time.Millisecond), Idempotent()),
+		"slow": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error { return nil }, ""),
+	}))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc/timeouts", nil))
+
+	var meta Meta
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]int{}
+	for _, m := range meta.Interfaces {
+		got[m.MethodName] = m.MethodTimeout
+		if m.Idempotent != (m.MethodName == "fast") {
+			t.Errorf("unexpected idempotent %v for %s", m.Idempotent, m.MethodName)
+		}
+	}
+
+	want := map[string]int{"fast": 250, "slow": 60000}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("method timeouts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctxID requestid.RequestID
+		buf   bytes.Buffer
+	)
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewLogfmtLogger(&buf), mux, NewService("reqid", "", EndpointCodecMap{
+		"fail": MakeVoidEndpointCodec(func(ctx context.Context, _ deadlineRequest) error {
+			ctxID, _ = requestid.FromContext(ctx)
+			_ = Logger(ctx).Log("msg", "from endpoint")
+			return errors.New("boom")
+		}, ""),
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/rpc/reqid/fail", strings.NewReader("{}"))
+	req.Header.Set("X-Request-ID", "upstream-id")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if ctxID.String() != "upstream-id" {
+		t.Errorf("expected endpoint to see request id %q, got %q", "upstream-id", ctxID)
+	}
+	if got := rec.Header().Get("X-Request-ID"); got != "upstream-id" {
+		t.Errorf("expected response header %q, got %q", "upstream-id", got)
+	}
+	for _, want := range []string{
+		"rpc_service=reqid method=fail request_id=upstream-id trace_id=",
+		"msg=\"from endpoint\"",
+		"err=boom",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected log to contain %q, got %q", want, buf.String())
+		}
+	}
+}
+
+func TestHandlerRequestIDPolicy(t *testing.T) {
+	t.Parallel()
+
+	// Only ids from 10.0.0.0/8 are trusted, and test requests come from
+	// 192.0.2.1
+	policy := WithRequestIDPolicy(requestid.Policy{TrustedUpstreams: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux, NewService("reqid", "", EndpointCodecMap{
+		"hello": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error { return nil }, ""),
+	}, policy, WithBatch(BatchOptions{})))
+	MountJSONRPC(log.NewNopLogger(), mux, "/jsonrpc", []*Service{newJSONRPCService(new(int32))}, policy)
+
+	for path, body := range map[string]string{
+		"/rpc/reqid/hello": `{}`,
+		"/rpc/reqid":       `[{"method":"hello"}]`,
+		"/jsonrpc":         `{"jsonrpc":"2.0","method":"orders.cancelOrder","params":{"id":"1"},"id":1}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-Request-ID", "untrusted-id")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("X-Request-ID"); got == "" || got == "untrusted-id" {
+			t.Errorf("%s: expected a new request id, got %q", path, got)
+		}
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	reg := prometheus.NewRegistry()
+
+	mux := http.NewServeMux()
+	Mount(log.NewLogfmtLogger(&buf), mux, []*Service{
+		NewService("panics", "", EndpointCodecMap{
+			"boom": MakeVoidEndpointCodec(func(context.Context, deadlineRequest) error {
+				panic("kaboom")
+			}, ""),
+		}),
+	}, WithRegisterer(reg))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/panics/boom", strings.NewReader("{}")))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+
+	var got Error
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Instance == "" || got.Message != "internal server error" {
+		t.Errorf("unexpected error body %+v", got)
+	}
+
+	for _, want := range []string{"rpc_service=panics method=boom", "panic=kaboom", "stack=", "error_id=" + got.Instance} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected log to contain %q, got %q", want, buf.String())
+		}
+	}
+
+	if n := testutil.ToFloat64(metricsFor(reg, nil).failures.WithLabelValues("panics", "boom", "panic")); n != 1 {
+		t.Errorf("expected 1 panic failure, got %v", n)
+	}
+}
+
+type placeOrderRequest struct {
+	ID    string  `json:"id"`
+	Total float64 `json:"total"`
+}
+
+func TestHandlerMultiArg(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		want       placeOrderRequest
+	}{
+		{
+			name:       "positional params",
+			method:     "positional",
+			body:       `["a", 1.5]`,
+			wantStatus: http.StatusOK,
+			want:       placeOrderRequest{ID: "a", Total: 1.5},
+		},
+		{
+			name:       "fewer positional params",
+			method:     "positional",
+			body:       `["a"]`,
+			wantStatus: http.StatusOK,
+			want:       placeOrderRequest{ID: "a"},
+		},
+		{
+			name:       "object params",
+			method:     "positional",
+			body:       `{"id":"a","total":2}`,
+			wantStatus: http.StatusOK,
+			want:       placeOrderRequest{ID: "a", Total: 2},
+		},
+		{
+			name:       "too many positional params",
+			method:     "positional",
+			body:       `["a", 1, true]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "positional params without opt in",
+			method:     "named",
+			body:       `["a", 1.5]`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got placeOrderRequest
+			place := func(_ context.Context, req placeOrderRequest) error {
+				got = req
+				return nil
+			}
+
+			mux := http.NewServeMux()
+			MountHandlers(log.NewNopLogger(), mux, NewService("orders", "", EndpointCodecMap{
+				"positional": MakeVoidEndpointCodec(place, "", MultiArg()),
+				"named":      MakeVoidEndpointCodec(place, ""),
+			}))
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc/orders/"+tc.method, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("request mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMetaMultiArg(t *testing.T) {
+	t.Parallel()
+
+	place := func(context.Context, placeOrderRequest) error { return nil }
+
+	mux := http.NewServeMux()
+	MountHandlers(log.NewNopLogger(), mux,
+		NewService("all", "", EndpointCodecMap{
+			"place": MakeVoidEndpointCodec(place, "", MultiArg()),
+		}),
+		NewService("some", "", EndpointCodecMap{
+			"place": MakeVoidEndpointCodec(place, "", MultiArg()),
+			"named": MakeVoidEndpointCodec(place, ""),
+		}),
+	)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+
+	var root RootMeta
+	if err := json.NewDecoder(rec.Body).Decode(&root); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, s := range root.Services {
+		got[s.ServiceName] = s.MultiArg
+		for _, m := range s.Interfaces {
+			got[s.ServiceName+"."+m.MethodName] = m.MultiArg
+		}
+	}
+
+	want := map[string]bool{"all": true, "all.place": true, "some": false, "some.place": true, "some.named": false}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("multiArg mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type fieldNamesBase struct {
+	ID      string `json:"id"`
+	Created string `json:"created"`
+}
+
+type fieldNamesTagged struct {
+	Note string
+}
+
+type fieldNamesRequest struct {
+	fieldNamesBase
+	*fieldNamesTagged `json:"tagged"`
+	Total             float64 `json:"total"`
+	Created           string  `json:"created"`
+	Skipped           string  `json:"-"`
+	Dash              string  `json:"-,"`
+	internal          string
+}
+
+func TestFieldNames(t *testing.T) {
+	t.Parallel()
+
+	_ = fieldNamesRequest{}.internal
+
+	// The keys encoding/json uses, in the order it writes them. The
+	// embedded "created" is hidden by the shallower one.
+	want := []string{"id", "tagged", "total", "created", "-"}
+	if diff := cmp.Diff(want, FieldNames(fieldNamesRequest{})); diff != "" {
+		t.Errorf("field names mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -26,12 +26,13 @@ func FromContext(ctx context.Context) (RequestID, bool) {
 }
 
 // NewContextFromRequest returns a new context that carries a RequestID. This ID
-// is either from X-Request-ID, or newly generated
+// is either from X-Request-ID, if DefaultPolicy accepts it, or newly generated
 func NewContextFromRequest(r *http.Request) context.Context {
-	ctx := r.Context()
-	if id := r.Header.Get("X-Request-ID"); id != "" {
-		return NewContext(ctx, RequestID{id})
-	}
+	return DefaultPolicy.NewContextFromRequest(r)
+}
 
-	return NewContext(ctx, NewRequestID())
+// Middleware wraps next so that every request context carries a RequestID,
+// using DefaultPolicy. See Policy.Middleware.
+func Middleware(next http.Handler) http.Handler {
+	return DefaultPolicy.Middleware(next)
 }
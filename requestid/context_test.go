@@ -0,0 +1,69 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		header string
+		ctxID  *RequestID
+		want   string
+	}{
+		{
+			name:   "uses inbound header",
+			header: "abc123",
+			want:   "abc123",
+		},
+		{
+			name:  "keeps id already in context",
+			ctxID: &RequestID{"from-ctx"},
+			want:  "from-ctx",
+		},
+		{
+			name: "generates id",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got RequestID
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var ok bool
+				got, ok = FromContext(r.Context())
+				if !ok {
+					t.Error("expected request id in context")
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("X-Request-ID", tc.header)
+			}
+			if tc.ctxID != nil {
+				req = req.WithContext(NewContext(context.Background(), *tc.ctxID))
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if tc.want != "" && got.String() != tc.want {
+				t.Errorf("expected id %q, got %q", tc.want, got)
+			}
+			if got.String() == "" {
+				t.Error("expected non empty id")
+			}
+			if echoed := rec.Header().Get("X-Request-ID"); echoed != got.String() {
+				t.Errorf("expected response header %q, got %q", got, echoed)
+			}
+		})
+	}
+}
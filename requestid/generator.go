@@ -0,0 +1,212 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Generator creates new RequestIDs.
+type Generator interface {
+	Generate() (RequestID, error)
+}
+
+// GeneratorFunc adapts a function to a Generator.
+type GeneratorFunc func() (RequestID, error)
+
+// Generate calls f.
+func (f GeneratorFunc) Generate() (RequestID, error) {
+	return f()
+}
+
+var (
+	// Random generates short, unordered ids from 6 random bytes, base64
+	// encoded. It is the default.
+	Random Generator = GeneratorFunc(randomID)
+
+	// ULID generates time sortable ULIDs, see https://github.com/ulid/spec.
+	ULID Generator = GeneratorFunc(ulidID)
+
+	// UUIDv4 generates random UUIDs.
+	UUIDv4 Generator = GeneratorFunc(uuidv4ID)
+
+	// UUIDv7 generates time sortable UUIDs.
+	UUIDv7 Generator = GeneratorFunc(uuidv7ID)
+)
+
+const prefixSep = '-'
+
+// Prefixed returns a Generator that prefixes ids from g with prefix, usually
+// the name of the originating service, e.g. "orders-01ARZ3NDEKTSV4RRFFQ69G5FAV".
+func Prefixed(prefix string, g Generator) Generator {
+	return GeneratorFunc(func() (RequestID, error) {
+		id, err := g.Generate()
+		if err != nil {
+			return RequestID{}, err
+		}
+		return RequestID{prefix + string(prefixSep) + id.str}, nil
+	})
+}
+
+var generator atomic.Value
+
+func init() {
+	generator.Store(generatorHolder{Random})
+}
+
+// generatorHolder keeps the concrete type stored in the atomic.Value
+// consistent.
+type generatorHolder struct {
+	Generator
+}
+
+// SetGenerator sets the Generator used by New, NewRequestID and for requests
+// without a valid inbound id.
+func SetGenerator(g Generator) {
+	generator.Store(generatorHolder{g})
+}
+
+func currentGenerator() Generator {
+	return generator.Load().(generatorHolder).Generator
+}
+
+func randomID() (RequestID, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return RequestID{}, fmt.Errorf("generating request id: %w", err)
+	}
+	return RequestID{base64.RawURLEncoding.EncodeToString(b)}, nil
+}
+
+const (
+	ulidLen = 26
+	uuidLen = 36
+
+	crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+func ulidID() (RequestID, error) {
+	var b [16]byte
+	putMillis(b[:6], time.Now())
+	if _, err := rand.Read(b[6:]); err != nil {
+		return RequestID{}, fmt.Errorf("generating request id: %w", err)
+	}
+
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	// 26 base32 characters hold 130 bits, the top 2 are always zero
+	var s [ulidLen]byte
+	for i := range s {
+		s[i] = crockford[shift128(hi, lo, uint(125-5*i))&0x1f]
+	}
+
+	return RequestID{string(s[:])}, nil
+}
+
+// shift128 returns the low 64 bits of the 128 bit value hi:lo shifted right by
+// n.
+func shift128(hi, lo uint64, n uint) uint64 {
+	switch {
+	case n >= 64:
+		return hi >> (n - 64)
+	case n == 0:
+		return lo
+	default:
+		return lo>>n | hi<<(64-n)
+	}
+}
+
+func ulidTime(s string) (time.Time, bool) {
+	if len(s) != ulidLen {
+		return time.Time{}, false
+	}
+
+	var ms uint64
+	for i := 0; i < ulidLen; i++ {
+		v := strings.IndexByte(crockford, upper(s[i]))
+		if v < 0 || (i == 0 && v > 7) {
+			return time.Time{}, false
+		}
+		// The first 10 characters are the 48 bit timestamp
+		if i < 10 {
+			ms = ms<<5 | uint64(v)
+		}
+	}
+
+	return time.UnixMilli(int64(ms)), true
+}
+
+func uuidv4ID() (RequestID, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return RequestID{}, fmt.Errorf("generating request id: %w", err)
+	}
+	return RequestID{formatUUID(b, 4)}, nil
+}
+
+func uuidv7ID() (RequestID, error) {
+	var b [16]byte
+	putMillis(b[:6], time.Now())
+	if _, err := rand.Read(b[6:]); err != nil {
+		return RequestID{}, fmt.Errorf("generating request id: %w", err)
+	}
+	return RequestID{formatUUID(b, 7)}, nil
+}
+
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [uuidLen]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+
+	return string(s[:])
+}
+
+func uuidv7Time(s string) (time.Time, bool) {
+	if len(s) != uuidLen || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' || s[14] != '7' {
+		return time.Time{}, false
+	}
+
+	var b [8]byte
+	if _, err := hex.Decode(b[2:6], []byte(s[0:8])); err != nil {
+		return time.Time{}, false
+	}
+	if _, err := hex.Decode(b[6:8], []byte(s[9:13])); err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(b[:]))), true
+}
+
+// putMillis writes t as a 48 bit big endian unix millisecond timestamp.
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
@@ -0,0 +1,89 @@
+package requestid
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGenerators(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		gen      Generator
+		pattern  string
+		sortable bool
+	}{
+		{name: "random", gen: Random, pattern: `^[A-Za-z0-9_-]{8}$`},
+		{name: "ulid", gen: ULID, pattern: `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, sortable: true},
+		{name: "uuidv4", gen: UUIDv4, pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{name: "uuidv7", gen: UUIDv7, pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, sortable: true},
+		{name: "prefixed ulid", gen: Prefixed("orders", ULID), pattern: `^orders-[0-7][0-9A-HJKMNP-TV-Z]{25}$`, sortable: true},
+		{name: "prefixed uuidv7", gen: Prefixed("order-api", UUIDv7), pattern: `^order-api-[0-9a-f-]{36}$`, sortable: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			before := time.Now().Truncate(time.Millisecond)
+			id, err := tc.gen.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := time.Now()
+
+			if !regexp.MustCompile(tc.pattern).MatchString(id.String()) {
+				t.Errorf("id %q doesn't match %s", id, tc.pattern)
+			}
+			if _, err := Parse(id.String()); err != nil {
+				t.Errorf("generated id rejected by DefaultPolicy: %v", err)
+			}
+
+			ts, ok := id.Time()
+			if ok != tc.sortable {
+				t.Fatalf("expected Time() ok %v, got %v", tc.sortable, ok)
+			}
+			if ok && (ts.Before(before) || ts.After(after)) {
+				t.Errorf("expected time between %v and %v, got %v", before, after, ts)
+			}
+		})
+	}
+}
+
+func TestRequestIDTime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		id     string
+		want   time.Time
+		wantOK bool
+	}{
+		{id: "01ARZ3NDEKTSV4RRFFQ69G5FAV", want: time.UnixMilli(1469922850259), wantOK: true},
+		{id: "01arz3ndektsv4rrffq69g5fav", want: time.UnixMilli(1469922850259), wantOK: true},
+		{id: "017f22e2-79b0-7cc3-98c4-dc0c0c07398f", want: time.UnixMilli(1645557742000), wantOK: true},
+		{id: "svc-017f22e2-79b0-7cc3-98c4-dc0c0c07398f", want: time.UnixMilli(1645557742000), wantOK: true},
+		{id: "8ARZ3NDEKTSV4RRFFQ69G5FAV0"},
+		{id: "0b3c8a4e-6f0e-4c1b-9a43-2a7f5c7c2b11"},
+		{id: "aGVsbG8-_w"},
+	}
+
+	for _, tc := range tests {
+		got, ok := RequestID{tc.id}.Time()
+		if ok != tc.wantOK || !got.Equal(tc.want) {
+			t.Errorf("RequestID{%q}.Time() = %v, %v, want %v, %v", tc.id, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestSetGenerator(t *testing.T) {
+	defer SetGenerator(Random)
+
+	SetGenerator(Prefixed("test", UUIDv4))
+
+	if id := NewRequestID(); !regexp.MustCompile(`^test-`).MatchString(id.String()) {
+		t.Errorf("expected id from configured generator, got %q", id)
+	}
+}
@@ -0,0 +1,130 @@
+package requestid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// DefaultMaxLength is the maximum length of an inbound request id, unless a
+// Policy sets its own.
+const DefaultMaxLength = 128
+
+// ErrInvalid is returned (wrapped) when a request id is rejected.
+var ErrInvalid = errors.New("invalid request id")
+
+// DefaultPolicy is the Policy used by Parse, NewContextFromRequest and
+// Middleware. Middleware copies it when called, so it must be set before
+// handlers are wrapped, e.g. before mounting lokerpc services.
+var DefaultPolicy = Policy{}
+
+// Policy controls which inbound X-Request-ID values are accepted. Rejected ids
+// are replaced with a newly generated one.
+type Policy struct {
+	// MaxLength is the maximum length of an id. Defaults to DefaultMaxLength.
+	MaxLength int
+
+	// Allowed reports whether a character may appear in an id. Defaults to
+	// ASCII letters, digits and "-_.:+/=", which covers base64, UUIDs and
+	// most tracing ids.
+	Allowed func(rune) bool
+
+	// TrustedUpstreams restricts accepting inbound ids to requests whose
+	// remote address is in one of these networks. If empty every upstream is
+	// trusted.
+	TrustedUpstreams []netip.Prefix
+}
+
+// Parse validates s, returning it as a RequestID.
+func (p Policy) Parse(s string) (RequestID, error) {
+	if s == "" {
+		return RequestID{}, fmt.Errorf("%w: empty", ErrInvalid)
+	}
+
+	maxLen := p.MaxLength
+	if maxLen <= 0 {
+		maxLen = DefaultMaxLength
+	}
+	if len(s) > maxLen {
+		return RequestID{}, fmt.Errorf("%w: longer than %d bytes", ErrInvalid, maxLen)
+	}
+
+	allowed := p.Allowed
+	if allowed == nil {
+		allowed = defaultAllowed
+	}
+	for _, r := range s {
+		if !allowed(r) {
+			return RequestID{}, fmt.Errorf("%w: contains %q", ErrInvalid, r)
+		}
+	}
+
+	return RequestID{s}, nil
+}
+
+// Trusted reports whether ids sent by the remote end of r should be accepted.
+func (p Policy) Trusted(r *http.Request) bool {
+	if len(p.TrustedUpstreams) == 0 {
+		return true
+	}
+
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := ap.Addr().Unmap()
+
+	for _, prefix := range p.TrustedUpstreams {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewContextFromRequest returns a new context that carries a RequestID. This ID
+// is from X-Request-ID if it is valid and from a trusted upstream, otherwise
+// it is newly generated.
+func (p Policy) NewContextFromRequest(r *http.Request) context.Context {
+	ctx := r.Context()
+	if h := r.Header.Get("X-Request-ID"); h != "" && p.Trusted(r) {
+		if id, err := p.Parse(h); err == nil {
+			return NewContext(ctx, id)
+		}
+	}
+
+	return NewContext(ctx, NewRequestID())
+}
+
+// Middleware wraps next so that every request context carries a RequestID. If
+// the context doesn't already have one, it is taken from X-Request-ID when
+// the policy accepts it, or newly generated. The ID is echoed in the
+// X-Request-ID response header.
+func (p Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := FromContext(r.Context())
+		if !ok {
+			ctx := p.NewContextFromRequest(r)
+			id, _ = FromContext(ctx)
+			r = r.WithContext(ctx)
+		}
+
+		w.Header().Set("X-Request-ID", id.String())
+		next.ServeHTTP(w, r)
+	})
+}
+
+func defaultAllowed(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	switch r {
+	case '-', '_', '.', ':', '+', '/', '=':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package requestid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestPolicyParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		id      string
+		wantErr bool
+	}{
+		{name: "base64", id: "aGVsbG8-_w"},
+		{name: "uuid", id: "0b3c8a4e-6f0e-4c1b-9a43-2a7f5c7c2b11"},
+		{name: "empty", id: "", wantErr: true},
+		{name: "newline", id: "abc\nlevel=error", wantErr: true},
+		{name: "space", id: "abc def", wantErr: true},
+		{name: "too long", id: strings.Repeat("a", DefaultMaxLength+1), wantErr: true},
+		{name: "custom max length", policy: Policy{MaxLength: 4}, id: "abcde", wantErr: true},
+		{name: "custom charset", policy: Policy{Allowed: unicode.IsDigit}, id: "123a", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			id, err := tc.policy.Parse(tc.id)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Errorf("expected ErrInvalid, got %v", err)
+			}
+			if err == nil && id.String() != tc.id {
+				t.Errorf("expected id %q, got %q", tc.id, id)
+			}
+		})
+	}
+}
+
+func TestPolicyNewContextFromRequest(t *testing.T) {
+	t.Parallel()
+
+	trusted := Policy{TrustedUpstreams: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		remoteAddr string
+		header     string
+		wantKept   bool
+	}{
+		{name: "valid id", header: "abc", wantKept: true},
+		{name: "invalid id", header: "abc\r\ndef", wantKept: false},
+		{name: "trusted upstream", policy: trusted, remoteAddr: "10.1.2.3:1234", header: "abc", wantKept: true},
+		{name: "untrusted upstream", policy: trusted, remoteAddr: "192.168.1.1:1234", header: "abc", wantKept: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("X-Request-ID", tc.header)
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+
+			id, ok := FromContext(tc.policy.NewContextFromRequest(req))
+			if !ok || id.String() == "" {
+				t.Fatal("expected request id in context")
+			}
+			if kept := id.String() == tc.header; kept != tc.wantKept {
+				t.Errorf("expected header kept %v, got id %q", tc.wantKept, id)
+			}
+		})
+	}
+}
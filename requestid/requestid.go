@@ -1,20 +1,63 @@
 package requestid
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"time"
 )
 
 type RequestID struct {
 	str string
 }
 
+// New returns a new RequestID from the current Generator.
+func New() (RequestID, error) {
+	return currentGenerator().Generate()
+}
+
+// NewRequestID returns a new RequestID from the current Generator, and panics
+// if it fails. Failure is only possible if the system random source is
+// broken.
 func NewRequestID() RequestID {
-	b := make([]byte, 6)
-	rand.Read(b)
-	return RequestID{base64.RawURLEncoding.EncodeToString(b)}
+	id, err := New()
+	if err != nil {
+		panic(err)
+	}
+	return id
 }
 
 func (id RequestID) String() string {
 	return id.str
 }
+
+// Time returns the creation time encoded in time sortable ids, ie those from
+// the ULID and UUIDv7 generators, optionally with a prefix. It returns false
+// for any other id.
+func (id RequestID) Time() (time.Time, bool) {
+	s := id.str
+
+	if t, ok := ulidTime(suffix(s, ulidLen)); ok {
+		return t, true
+	}
+	if t, ok := uuidv7Time(suffix(s, uuidLen)); ok {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// suffix returns the last n bytes of s, if they make up the whole of s or
+// follow a prefix separator.
+func suffix(s string, n int) string {
+	switch {
+	case len(s) == n:
+		return s
+	case len(s) > n && s[len(s)-n-1] == prefixSep:
+		return s[len(s)-n:]
+	default:
+		return ""
+	}
+}
+
+// Parse validates s using DefaultPolicy, returning it as a RequestID.
+func Parse(s string) (RequestID, error) {
+	return DefaultPolicy.Parse(s)
+}
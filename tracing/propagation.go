@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+
+	// maxTraceStateLen is the maximum length of tracestate we propagate, as
+	// recommended by the W3C spec.
+	maxTraceStateLen = 512
+)
+
+// ErrInvalidTraceparent is returned (wrapped) for malformed traceparent
+// headers.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a W3C traceparent header value. The returned
+// SpanContext has no TraceState.
+func ParseTraceparent(s string) (SpanContext, error) {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	const size = 2 + 1 + 32 + 1 + 16 + 1 + 2
+
+	if len(s) < size || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return SpanContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, s)
+	}
+
+	version, err := hex.DecodeString(s[:2])
+	if err != nil || version[0] == 0xff {
+		return SpanContext{}, fmt.Errorf("%w: bad version %q", ErrInvalidTraceparent, s[:2])
+	}
+	// Version 00 has an exact size, future versions may append fields
+	if (version[0] == 0 && len(s) != size) || (len(s) > size && s[size] != '-') {
+		return SpanContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, s)
+	}
+
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil || !isLowerHex(s[3:35]) {
+		return SpanContext{}, fmt.Errorf("%w: bad trace-id", ErrInvalidTraceparent)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil || !isLowerHex(s[36:52]) {
+		return SpanContext{}, fmt.Errorf("%w: bad parent-id", ErrInvalidTraceparent)
+	}
+	flags, err := strconv.ParseUint(s[53:55], 16, 8)
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("%w: bad trace-flags", ErrInvalidTraceparent)
+	}
+	sc.Flags = byte(flags)
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w: zero id", ErrInvalidTraceparent)
+	}
+
+	return sc, nil
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// Extract reads the traceparent and tracestate headers from h.
+func Extract(h http.Header) (SpanContext, bool) {
+	tp := h.Get(traceparentHeader)
+	if tp == "" {
+		return SpanContext{}, false
+	}
+
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	if ts := h.Get(tracestateHeader); len(ts) <= maxTraceStateLen {
+		sc.TraceState = ts
+	}
+
+	return sc, true
+}
+
+// Inject writes the current span context in ctx to h, if there is one.
+func Inject(ctx context.Context, h http.Header) {
+	sc, ok := FromContext(ctx)
+	if !ok || !sc.IsValid() {
+		return
+	}
+
+	h.Set(traceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(tracestateHeader, sc.TraceState)
+	}
+}
+
+// Middleware wraps next so that each request runs in a server span named
+// name, continuing the trace from the inbound traceparent header if present.
+func Middleware(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := Extract(r.Header); ok {
+			ctx = NewContext(ctx, sc)
+		}
+
+		ctx, span := Start(ctx, name, KindServer)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", strconv.Itoa(sw.status))
+		if sw.status >= 500 {
+			span.SetError(errors.New(http.StatusText(sw.status)))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		sampled bool
+		wantErr bool
+	}{
+		{
+			name:    "sampled",
+			in:      "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled: true,
+		},
+		{
+			name: "not sampled",
+			in:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			want: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{
+			name:    "future version with extra fields",
+			in:      "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			want:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled: true,
+		},
+		{name: "empty", in: "", wantErr: true},
+		{name: "version ff", in: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "version 00 with extra", in: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "zero trace id", in: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero span id", in: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "upper case", in: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "bad separators", in: "00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sc, err := ParseTraceparent(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseTraceparent() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidTraceparent) {
+					t.Errorf("expected ErrInvalidTraceparent, got %v", err)
+				}
+				return
+			}
+			if got := sc.Traceparent(); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if sc.IsSampled() != tc.sampled {
+				t.Errorf("expected sampled %v", tc.sampled)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	exp := &InMemoryExporter{}
+	tracer := NewTracer(exp)
+
+	// Start the client span with our own tracer, the server span is a child of
+	// it so uses the default tracer
+	ctx, client := tracer.Start(context.Background(), "client", KindClient)
+	client.End()
+
+	var server SpanContext
+	h := Middleware("server", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server, _ = FromContext(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	Inject(ctx, req.Header)
+	req.Header.Set("tracestate", "vendor=value")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if server.TraceID != client.SpanContext().TraceID {
+		t.Errorf("expected server span in trace %s, got %s", client.SpanContext().TraceID, server.TraceID)
+	}
+	if server.SpanID == client.SpanContext().SpanID {
+		t.Error("expected server span to have its own span id")
+	}
+	if server.TraceState != "vendor=value" {
+		t.Errorf("expected tracestate to be propagated, got %q", server.TraceState)
+	}
+}
@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanKind describes the relationship of a span to its parent and children.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = iota
+	KindServer
+	KindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+// SpanData is a finished span, as passed to an Exporter.
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Err          error
+}
+
+// Exporter receives spans as they end. Only sampled spans are exported.
+type Exporter interface {
+	ExportSpan(SpanData)
+}
+
+// Tracer starts spans, and sends them to its Exporter once they end.
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer creates a Tracer that exports to exp. A nil exp discards spans,
+// while still propagating trace context.
+func NewTracer(exp Exporter) *Tracer {
+	return &Tracer{exporter: exp}
+}
+
+var defaultTracer atomic.Value
+
+func init() {
+	defaultTracer.Store(NewTracer(nil))
+}
+
+// Default returns the Tracer used when ctx doesn't already carry a span.
+func Default() *Tracer {
+	return defaultTracer.Load().(*Tracer)
+}
+
+// SetDefault sets the Tracer used when ctx doesn't already carry a span.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span that is a child of the current span in ctx, using that
+// span's Tracer, or the Default tracer if there is none.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := Default()
+	if s := SpanFromContext(ctx); s != nil {
+		t = s.tracer
+	}
+	return t.Start(ctx, name, kind)
+}
+
+// Start starts a span that is a child of the current span in ctx, or the root
+// of a new trace if there is none. The span must be ended with End.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	sc := SpanContext{SpanID: newSpanID()}
+
+	var parentID SpanID
+	if parent, ok := FromContext(ctx); ok && parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+		parentID = parent.SpanID
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Flags = FlagSampled
+	}
+
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:         name,
+			Kind:         kind,
+			SpanContext:  sc,
+			ParentSpanID: parentID,
+			Start:        time.Now(),
+		},
+	}
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Span is an operation within a trace.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the propagated part of the span.
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]string{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Err = err
+}
+
+// End finishes the span and exports it. Calls after the first are ignored.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil && data.SpanContext.IsSampled() {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTracerStart(t *testing.T) {
+	t.Parallel()
+
+	exp := &InMemoryExporter{}
+	tracer := NewTracer(exp)
+
+	ctx, root := tracer.Start(context.Background(), "root", KindServer)
+	_, child := Start(ctx, "child", KindClient)
+	child.SetAttribute("key", "value")
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	c, r := spans[0], spans[1]
+	if c.SpanContext.TraceID != r.SpanContext.TraceID {
+		t.Error("expected child to share the root trace id")
+	}
+	if c.ParentSpanID != r.SpanContext.SpanID {
+		t.Error("expected child parent to be the root span")
+	}
+	if r.ParentSpanID.IsValid() {
+		t.Error("expected root to have no parent")
+	}
+	if c.Attributes["key"] != "value" || c.Err == nil {
+		t.Errorf("expected child attributes and error, got %+v", c)
+	}
+}
+
+func TestTracerNotSampled(t *testing.T) {
+	t.Parallel()
+
+	exp := &InMemoryExporter{}
+	tracer := NewTracer(exp)
+
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := tracer.Start(NewContext(context.Background(), parent), "span", KindServer)
+	span.End()
+
+	if len(exp.Spans()) != 0 {
+		t.Error("expected unsampled span not to be exported")
+	}
+}